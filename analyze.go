@@ -0,0 +1,332 @@
+package boltcli
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// leafElementSize is the bolt leaf element header stored with every key.
+const leafElementSize = 16
+
+// DefaultSeparators are the bytes splitting a key into the segments of the prefix rollup.
+const DefaultSeparators = ":/._-|#"
+
+// NoPrefix is the prefix of the rollup which groups the keys without any separator.
+const NoPrefix = "(no prefix)"
+
+// AnalyzeOption tunes Analyze, the zero values use the defaults.
+type AnalyzeOption struct {
+	// Top is the number of the largest keys, and of the prefixes kept per level, default 10.
+	Top int
+	// Depth is the number of key segments of the prefix rollup, default 2.
+	Depth int
+	// Separators end a key segment, default DefaultSeparators.
+	Separators string
+}
+
+// maxPrefixNodes bounds the nodes of the prefix rollup, the keys of the later new prefixes are rolled up
+// as the others of their parent, so a bucket of many unique prefixes takes no more memory.
+var maxPrefixNodes = 10000
+
+// SizeStats is the distribution of key or value sizes in bytes.
+// The percentiles are estimated within 1/8 of the size by a log scale histogram.
+type SizeStats struct {
+	Total int64   `json:"total"`
+	Avg   float64 `json:"avg"`
+	Min   int     `json:"min"`
+	P50   int     `json:"p50"`
+	P90   int     `json:"p90"`
+	P99   int     `json:"p99"`
+	Max   int     `json:"max"`
+}
+
+// PrefixInfo is the rollup of the keys sharing a prefix.
+type PrefixInfo struct {
+	Prefix string `json:"prefix"`
+	Depth  int    `json:"depth"`
+	KeyN   int    `json:"keyN"`
+	// Bytes is the estimated bytes of the keys, the values and their leaf elements.
+	Bytes int64 `json:"bytes"`
+	// Other is true for the rollup of the prefixes beyond the top ones of a level, Prefix is their parent.
+	Other bool `json:"other,omitempty"`
+}
+
+// Analysis tells where the bytes of a bucket go.
+// The keys of the nested buckets are counted as bucket/key, so they roll up under their bucket.
+type Analysis struct {
+	Path      string       `json:"path"`
+	KeyN      int          `json:"keyN"`
+	BucketN   int          `json:"bucketN"`
+	Alloc     int          `json:"alloc"`
+	Inuse     int          `json:"inuse"`
+	KeySize   SizeStats    `json:"keySize"`
+	ValueSize SizeStats    `json:"valueSize"`
+	TopKeys   []KeyInfo    `json:"topKeys"`
+	Prefixes  []PrefixInfo `json:"prefixes"`
+}
+
+// prefixNode is a node of the key segment trie.
+type prefixNode struct {
+	keyN     int
+	bytes    int64
+	children map[string]*prefixNode
+	// otherN and otherBytes count the keys of the prefixes beyond the node budget.
+	otherN     int
+	otherBytes int64
+}
+
+// add adds a key of the segments, creating at most budget nodes.
+func (n *prefixNode) add(segments []string, size int64, budget *int) {
+	n.keyN++
+	n.bytes += size
+	if len(segments) == 0 {
+		return
+	}
+
+	child := n.children[segments[0]]
+	if child == nil {
+		if *budget <= 0 {
+			n.otherN++
+			n.otherBytes += size
+			return
+		}
+		*budget--
+
+		if n.children == nil {
+			n.children = make(map[string]*prefixNode)
+		}
+		child = &prefixNode{}
+		n.children[segments[0]] = child
+	}
+
+	child.add(segments[1:], size, budget)
+}
+
+// rollup flattens the trie depth first, keeping the top largest children of each node.
+func (n *prefixNode) rollup(prefix string, depth, top int, out []PrefixInfo) []PrefixInfo {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := n.children[names[i]], n.children[names[j]]
+		return a.bytes > b.bytes || a.bytes == b.bytes && names[i] < names[j]
+	})
+
+	other := PrefixInfo{Prefix: prefix, Depth: depth + 1, KeyN: n.otherN, Bytes: n.otherBytes, Other: true}
+	for i, name := range names {
+		child := n.children[name]
+		if i >= top {
+			other.KeyN += child.keyN
+			other.Bytes += child.bytes
+			continue
+		}
+
+		out = append(out, PrefixInfo{Prefix: prefix + name, Depth: depth + 1, KeyN: child.keyN, Bytes: child.bytes})
+		out = child.rollup(prefix+name, depth+1, top, out)
+	}
+
+	if other.KeyN > 0 {
+		out = append(out, other)
+	}
+
+	return out
+}
+
+// splitSegments splits the key after each separator up to depth segments, the last one is dropped
+// when it is the whole rest of the key, so a unique key tail does not become a prefix of its own.
+func splitSegments(key []byte, separators string, depth int) []string {
+	var segments []string
+	for len(segments) < depth {
+		i := bytes.IndexAny(key, separators)
+		if i < 0 {
+			break
+		}
+		segments = append(segments, string(key[:i+1]))
+		key = key[i+1:]
+	}
+
+	if len(segments) == 0 {
+		// the keys without any separator share one group, not a prefix each.
+		segments = append(segments, NoPrefix)
+	}
+
+	return segments
+}
+
+// sizeHistogram counts the sizes in log scale buckets, the sizes below 16 exactly and the larger ones
+// in 8 buckets per power of two, so its memory does not grow with the number of sizes.
+type sizeHistogram struct {
+	counts   [16 + 8*60]int64
+	n, total int64
+	min, max int
+}
+
+func sizeBucket(size int) int {
+	if size < 16 {
+		return size
+	}
+
+	e := bits.Len(uint(size)) - 1
+	return 16 + (e-4)*8 + (size>>(e-3))&7
+}
+
+// bucketMax is the largest size of the bucket i.
+func bucketMax(i int) int {
+	if i < 16 {
+		return i
+	}
+
+	e, sub := (i-16)/8+4, (i-16)%8
+	return (8+sub+1)<<(e-3) - 1
+}
+
+func (h *sizeHistogram) add(size int) {
+	if h.n == 0 || size < h.min {
+		h.min = size
+	}
+	if size > h.max {
+		h.max = size
+	}
+	h.n++
+	h.total += int64(size)
+	h.counts[sizeBucket(size)]++
+}
+
+// percentile estimates the size below which p percent of the sizes are, by the bucket holding it.
+func (h *sizeHistogram) percentile(p int) int {
+	rank, seen := (h.n-1)*int64(p)/100, int64(0)
+	for i, count := range h.counts {
+		if seen += count; seen > rank {
+			size := bucketMax(i)
+			if size > h.max {
+				size = h.max
+			}
+			if size < h.min {
+				size = h.min
+			}
+			return size
+		}
+	}
+
+	return h.max
+}
+
+func (h *sizeHistogram) stats() SizeStats {
+	var s SizeStats
+	if h.n == 0 {
+		return s
+	}
+
+	s.Total, s.Avg = h.total, float64(h.total)/float64(h.n)
+	s.Min, s.P50, s.P90, s.P99, s.Max = h.min, h.percentile(50), h.percentile(90), h.percentile(99), h.max
+	return s
+}
+
+// Analyze reads every key of the nested bucket of path and reports the key count, the key and value
+// size percentiles, the largest keys and the bytes per common key prefix.
+func (c *DB) Analyze(path [][]byte, opt AnalyzeOption) (*Analysis, error) {
+	if opt.Top <= 0 {
+		opt.Top = 10
+	}
+	if opt.Depth <= 0 {
+		opt.Depth = 2
+	}
+	if opt.Separators == "" {
+		opt.Separators = DefaultSeparators
+	}
+
+	a := &Analysis{Path: FormatPath(path)}
+	var keySizes, valueSizes sizeHistogram
+	keys := &keyHeap{}
+	root, budget := &prefixNode{}, maxPrefixNodes
+
+	var scan func(b *bolt.Bucket, bucketPath [][]byte, prefix []byte) error
+	scan = func(b *bolt.Bucket, bucketPath [][]byte, prefix []byte) error {
+		return b.ForEach(func(k, v []byte) error {
+			full := append(prefix[:len(prefix):len(prefix)], k...)
+			if v == nil {
+				a.BucketN++
+				nested := append(bucketPath[:len(bucketPath):len(bucketPath)], k)
+				return scan(b.Bucket(k), nested, append(full, PathSeparator...))
+			}
+
+			a.KeyN++
+			keySizes.add(len(k))
+			valueSizes.add(len(v))
+			root.add(splitSegments(full, opt.Separators, opt.Depth), int64(len(k)+len(v)+leafElementSize), &budget)
+
+			if keys.Len() < opt.Top || len(v) > (*keys)[0].Size {
+				heap.Push(keys, KeyInfo{Path: FormatPath(bucketPath), Key: string(k), Size: len(v)})
+				if keys.Len() > opt.Top {
+					heap.Pop(keys)
+				}
+			}
+
+			return nil
+		})
+	}
+
+	err := c.view(func(tx *bolt.Tx) error {
+		b := bucketAt(tx, path)
+		if b == nil {
+			return ErrBucketNotFound
+		}
+
+		s := b.Stats()
+		a.Alloc, a.Inuse = s.BranchAlloc+s.LeafAlloc, s.BranchInuse+s.LeafInuse
+		return scan(b, path, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.KeySize, a.ValueSize = keySizes.stats(), valueSizes.stats()
+	for keys.Len() > 0 {
+		a.TopKeys = append([]KeyInfo{heap.Pop(keys).(KeyInfo)}, a.TopKeys...)
+	}
+	a.Prefixes = root.rollup("", 0, opt.Top, nil)
+
+	return a, nil
+}
+
+// Fprint prints the analysis as text.
+func (a *Analysis) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "Bucket          = %s\n", a.Path)
+	fmt.Fprintf(w, "KeyN            = %d\n", a.KeyN)
+	fmt.Fprintf(w, "BucketN         = %d\t // nested buckets\n", a.BucketN)
+	fmt.Fprintf(w, "Alloc           = %d\t // bytes allocated by the pages\n", a.Alloc)
+	fmt.Fprintf(w, "Inuse           = %d\t // bytes in use of the pages\n", a.Inuse)
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "%-6s %12s %10s %8s %8s %8s %8s %10s\n", "Size", "Total", "Avg", "Min", "P50", "P90", "P99", "Max")
+	for _, s := range []struct {
+		name string
+		SizeStats
+	}{{"Key", a.KeySize}, {"Value", a.ValueSize}} {
+		fmt.Fprintf(w, "%-6s %12d %10.1f %8d %8d %8d %8d %10d\n", s.name, s.Total, s.Avg, s.Min, s.P50, s.P90, s.P99, s.Max)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Largest keys (value bytes).")
+	for _, k := range a.TopKeys {
+		fmt.Fprintf(w, "%-40s %12d\n", k.Path+PathSeparator+k.Key, k.Size)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Key prefixes (keys, estimated bytes).")
+	for _, p := range a.Prefixes {
+		name := p.Prefix
+		if p.Other {
+			name += "(others)"
+		}
+		fmt.Fprintf(w, "%-40s %10d %12d\n", strings.Repeat("  ", p.Depth-1)+name, p.KeyN, p.Bytes)
+	}
+}
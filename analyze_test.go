@@ -0,0 +1,96 @@
+package boltcli
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	c := newTestDB(t)
+
+	assert.Nil(t, c.WithPath(ParsePath("a")...).Put(
+		[]byte("user:1:name"), []byte("bob"),
+		[]byte("user:1:photo"), []byte(strings.Repeat("x", 100)),
+		[]byte("user:2:name"), []byte("alice"),
+		[]byte("order:1"), []byte("o1"),
+		[]byte("plain"), []byte("p"),
+	))
+	assert.Nil(t, c.WithPath(ParsePath("a/sub")...).Put([]byte("k"), []byte("v")))
+
+	a, err := c.Analyze(ParsePath("a"), AnalyzeOption{Top: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 6, a.KeyN)
+	assert.Equal(t, 1, a.BucketN)
+	assert.Equal(t, 1, a.ValueSize.Min)
+	assert.Equal(t, 100, a.ValueSize.Max)
+	assert.Equal(t, []KeyInfo{{Path: "/a", Key: "user:1:photo", Size: 100}, {Path: "/a", Key: "user:2:name", Size: 5}}, a.TopKeys)
+
+	var prefixes []string
+	for _, p := range a.Prefixes {
+		prefixes = append(prefixes, p.Prefix)
+	}
+	assert.Equal(t, []string{"user:", "user:1:", "user:2:", "order:", ""}, prefixes)
+	// plain and sub/k are rolled up beyond the top 2 of the first level.
+	assert.Equal(t, PrefixInfo{Depth: 1, KeyN: 2, Bytes: 5 + 1 + 1 + 1 + 2*leafElementSize, Other: true}, a.Prefixes[4])
+
+	_, err = c.Analyze(ParsePath("nope"), AnalyzeOption{})
+	assert.Equal(t, ErrBucketNotFound, err)
+}
+
+func TestAnalyzeNoPrefix(t *testing.T) {
+	c := newTestDB(t)
+
+	b := c.WithPath(ParsePath("a")...)
+	kvs := make([][]byte, 0, 2*10000)
+	for i := 0; i < 10000; i++ {
+		kvs = append(kvs, []byte(fmt.Sprintf("key%05d", i)), []byte("v"))
+	}
+	assert.Nil(t, b.Put(kvs[0], kvs[1], kvs[2:]...))
+
+	a, err := c.Analyze(ParsePath("a"), AnalyzeOption{Top: 100000})
+	assert.Nil(t, err)
+	assert.Equal(t, []PrefixInfo{{Prefix: NoPrefix, Depth: 1, KeyN: 10000, Bytes: 10000 * (8 + 1 + leafElementSize)}}, a.Prefixes)
+}
+
+func TestAnalyzeBounded(t *testing.T) {
+	defer func(n int) { maxPrefixNodes = n }(maxPrefixNodes)
+	maxPrefixNodes = 100
+
+	c := newTestDB(t)
+	b := c.WithPath(ParsePath("a")...)
+	kvs := make([][]byte, 0, 2*1000)
+	for i := 0; i < 1000; i++ {
+		kvs = append(kvs, []byte(fmt.Sprintf("u%d:x", i)), []byte(strings.Repeat("v", i)))
+	}
+	assert.Nil(t, b.Put(kvs[0], kvs[1], kvs[2:]...))
+
+	a, err := c.Analyze(ParsePath("a"), AnalyzeOption{Top: 100000})
+	assert.Nil(t, err)
+	assert.True(t, len(a.Prefixes) <= 101)
+	keyN := 0
+	for _, p := range a.Prefixes {
+		if p.Depth == 1 {
+			keyN += p.KeyN
+		}
+	}
+	assert.Equal(t, 1000, keyN)
+	// the keys beyond the node budget are rolled up as the others.
+	assert.True(t, a.Prefixes[len(a.Prefixes)-1].Other)
+
+	assert.Equal(t, 0, a.ValueSize.Min)
+	assert.Equal(t, 999, a.ValueSize.Max)
+	assert.Equal(t, int64(999*1000/2), a.ValueSize.Total)
+	assert.InEpsilon(t, 499, a.ValueSize.P50, 0.125)
+	assert.InEpsilon(t, 900, a.ValueSize.P90, 0.125)
+	assert.InEpsilon(t, 989, a.ValueSize.P99, 0.125)
+}
+
+func TestSizeHistogram(t *testing.T) {
+	for size := 0; size < 1<<20; size += 1 + size/7 {
+		i := sizeBucket(size)
+		assert.True(t, size <= bucketMax(i), size)
+		assert.True(t, i == 0 || bucketMax(i-1) < size, size)
+	}
+}
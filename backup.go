@@ -0,0 +1,410 @@
+package boltcli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrNoFullBackup     = errors.New("no full backup in the manifest")
+	ErrNoChanges        = errors.New("no journal changes since the last backup")
+)
+
+// BackupEntry is a backup file recorded in the manifest.
+type BackupEntry struct {
+	File        string    `json:"file"`
+	Time        time.Time `json:"time"`
+	TxID        int       `json:"txId"`
+	Compression string    `json:"compression,omitempty"`
+	// Size is the size of the backup file, DataSize the size of the db it holds.
+	Size     int64  `json:"size"`
+	DataSize int64  `json:"dataSize"`
+	SHA256   string `json:"sha256"`
+	// Base is the full backup of an incremental backup, which holds the journal records
+	// after the previous backup of the same base up to TxID.
+	Base string `json:"base,omitempty"`
+}
+
+// Manifest lists the backups of a db in a backup dir, the oldest first.
+type Manifest struct {
+	DbFile  string        `json:"dbFile"`
+	Backups []BackupEntry `json:"backups"`
+}
+
+// ManifestFile is the manifest of the backups of the db file in dir.
+func ManifestFile(dir, dbFile string) string {
+	return filepath.Join(dir, filepath.Base(dbFile)+".manifest.json")
+}
+
+// LoadManifest loads the manifest file, a missing file is an empty manifest.
+func LoadManifest(file string) (*Manifest, error) {
+	m := &Manifest{}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", file, err)
+	}
+
+	return m, nil
+}
+
+// Save writes the manifest to a temporary file renamed over file, so it is never half written.
+func (m *Manifest) Save(file string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+// LatestFull returns the latest full backup, nil if none.
+func (m *Manifest) LatestFull() *BackupEntry {
+	for i := len(m.Backups) - 1; i >= 0; i-- {
+		if m.Backups[i].Base == "" {
+			return &m.Backups[i]
+		}
+	}
+
+	return nil
+}
+
+// Increments returns the incremental backups of the full backup, in the order to replay them.
+func (m *Manifest) Increments(base string) []BackupEntry {
+	var entries []BackupEntry
+	for _, e := range m.Backups {
+		if e.Base == base {
+			entries = append(entries, e)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].TxID < entries[j].TxID })
+	return entries
+}
+
+// BackupTo streams a consistent copy of the db to w, it returns the number of bytes written.
+// Wrap w with NewCompressWriter for a compressed copy.
+func (c *DB) BackupTo(w io.Writer) (n int64, err error) {
+	err = c.DB.View(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+		return err
+	})
+
+	return n, err
+}
+
+// BackupFile writes a backup named DbFile-YYYYMMDDHHMMSS.bak with the compression extension into dir,
+// checks it by reopening the copy, and records it with its checksum in the manifest of dir.
+// The later backups in the same second are named DbFile-YYYYMMDDHHMMSS-N.bak, N counting from 2.
+func (c *DB) BackupFile(dir, compression string) (*BackupEntry, error) {
+	e := &BackupEntry{Time: time.Now(), Compression: compression}
+	if err := c.writeBackup(dir, e); err != nil {
+		return nil, err
+	}
+
+	target := filepath.Join(dir, e.File)
+	if err := VerifyBackup(target, e.SHA256); err != nil {
+		os.Remove(target)
+		return nil, fmt.Errorf("verify backup %s: %w", target, err)
+	}
+
+	file := ManifestFile(dir, c.DbFile)
+	m, err := LoadManifest(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m.DbFile, _ = filepath.Abs(c.DbFile)
+	m.Backups = append(m.Backups, *e)
+	return e, m.Save(file)
+}
+
+func (c *DB) writeBackup(dir string, e *BackupEntry) error {
+	return writeBackupFile(dir, filepath.Base(c.DbFile), ".bak", e, func(w io.Writer) error {
+		return c.DB.View(func(tx *bolt.Tx) (err error) {
+			e.TxID = tx.ID()
+			e.DataSize, err = tx.WriteTo(w)
+			return err
+		})
+	})
+}
+
+// writeBackupFile writes a new backup file of the db named base into dir by write through the compression of e,
+// and sets the name, the size and the checksum of e. The file is removed on failures.
+func writeBackupFile(dir, base, ext string, e *BackupEntry, write func(w io.Writer) error) error {
+	f, err := createBackupFile(dir, base, ext, e)
+	if err != nil {
+		return err
+	}
+
+	target := f.Name()
+	h := sha256.New()
+	err = func() error {
+		cw, err := NewCompressWriter(io.MultiWriter(f, h), e.Compression)
+		if err != nil {
+			return err
+		}
+
+		err = write(cw)
+		if cerr := cw.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = f.Sync()
+		}
+
+		return err
+	}()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+
+	e.SHA256 = hex.EncodeToString(h.Sum(nil))
+	fi, err := os.Stat(target)
+	if err == nil {
+		e.Size = fi.Size()
+	}
+
+	return err
+}
+
+// createBackupFile creates the backup file named base-YYYYMMDDHHMMSS by the time of e with the extension ext
+// and the one of the compression, adding a counter when the name is taken, and sets its name to e.
+func createBackupFile(dir, base, ext string, e *BackupEntry) (*os.File, error) {
+	stamp := base + "-" + e.Time.Format("20060102150405")
+	for n := 1; ; n++ {
+		e.File = stamp + ext + CompressionExt(e.Compression)
+		if n > 1 {
+			e.File = stamp + "-" + strconv.Itoa(n) + ext + CompressionExt(e.Compression)
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, e.File), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if !os.IsExist(err) {
+			return f, err
+		}
+	}
+}
+
+// VerifyBackup checks the sha256 checksum of the backup file when it is not empty,
+// decompresses it into a temporary file and runs the bolt consistency check on it.
+func VerifyBackup(file, checksum string) error {
+	tmp, err := ExtractBackup(file, checksum, filepath.Dir(file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	return CheckFile(tmp)
+}
+
+// ExtractBackup decompresses the backup file into a temporary file in dir and returns its name.
+// The checksum of the backup file is checked when it is not empty.
+func ExtractBackup(file, checksum, dir string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(f, head)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	r, err := NewDecompressReader(io.TeeReader(f, h), DetectCompression(head[:n]))
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.CreateTemp(dir, filepath.Base(file)+".*.tmp")
+	if err != nil {
+		r.Close()
+		return "", err
+	}
+
+	_, err = io.Copy(out, r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	// a corrupted file tells the checksum mismatch rather than the decompression error.
+	if _, cerr := io.Copy(h, f); cerr == nil && checksum != "" && hex.EncodeToString(h.Sum(nil)) != checksum {
+		err = ErrChecksumMismatch
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+
+	return out.Name(), nil
+}
+
+// CheckFile opens the bolt file read only and runs the bolt consistency check on it.
+func CheckFile(file string) error {
+	db, err := bolt.Open(file, 0600, &bolt.Options{ReadOnly: true, Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		var errs []string
+		for err := range tx.Check() {
+			errs = append(errs, err.Error())
+		}
+
+		if len(errs) > 0 {
+			return fmt.Errorf("%d consistency errors: %s", len(errs), strings.Join(errs, "; "))
+		}
+
+		return nil
+	})
+}
+
+// BackupIncremental writes the journal records after the previous backup of the latest full backup
+// of the db file in dir into a backup named DbFile-YYYYMMDDHHMMSS.inc with the compression extension like BackupFile,
+// and records it in the manifest. It returns ErrNoChanges when there is nothing to back up,
+// and ErrJournalBroken when the journal misses a transaction after the full backup.
+func BackupIncremental(dir, dbFile, journalDir, compression string) (*BackupEntry, error) {
+	file := ManifestFile(dir, dbFile)
+	m, err := LoadManifest(file)
+	if err != nil {
+		return nil, err
+	}
+
+	base := m.LatestFull()
+	if base == nil {
+		return nil, ErrNoFullBackup
+	}
+
+	after := base.TxID
+	for _, e := range m.Increments(base.File) {
+		if e.TxID > after {
+			after = e.TxID
+		}
+	}
+
+	if lost, err := JournalBroken(journalDir); err != nil {
+		return nil, err
+	} else if lost > base.TxID {
+		return nil, ErrJournalBroken
+	}
+
+	errFound := errors.New("found")
+	err = ReadJournal(journalDir, after, func(JournalRecord) error { return errFound })
+	if err == nil {
+		return nil, ErrNoChanges
+	}
+	if err != errFound {
+		return nil, err
+	}
+
+	e := &BackupEntry{Time: time.Now(), Compression: compression, Base: base.File, TxID: after}
+	if err := writeIncrement(dir, filepath.Base(dbFile), journalDir, e); err != nil {
+		return nil, err
+	}
+
+	m.Backups = append(m.Backups, *e)
+	return e, m.Save(file)
+}
+
+func writeIncrement(dir, base, journalDir string, e *BackupEntry) error {
+	return writeBackupFile(dir, base, ".inc", e, func(w io.Writer) error {
+		err := ReadJournal(journalDir, e.TxID, func(r JournalRecord) error {
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+
+			n, err := w.Write(append(data, '\n'))
+			e.DataSize += int64(n)
+			if r.TxID > e.TxID {
+				e.TxID = r.TxID
+			}
+			return err
+		})
+		if err == nil && e.DataSize == 0 {
+			err = ErrNoChanges
+		}
+
+		return err
+	})
+}
+
+// PruneBackups removes the oldest full backups of the db file in dir beyond the newest keep ones
+// with their incremental backups, it returns the removed entries.
+func PruneBackups(dir, dbFile string, keep int) ([]BackupEntry, error) {
+	file := ManifestFile(dir, dbFile)
+	m, err := LoadManifest(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var fulls []BackupEntry
+	for _, e := range m.Backups {
+		if e.Base == "" {
+			fulls = append(fulls, e)
+		}
+	}
+	if len(fulls) <= keep {
+		return nil, nil
+	}
+
+	sort.SliceStable(fulls, func(i, j int) bool { return fulls[i].Time.Before(fulls[j].Time) })
+	pruned := make(map[string]bool)
+	for _, e := range fulls[:len(fulls)-keep] {
+		pruned[e.File] = true
+	}
+
+	var removed, kept []BackupEntry
+	for _, e := range m.Backups {
+		if !pruned[e.File] && !pruned[e.Base] {
+			kept = append(kept, e)
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, e.File)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		removed = append(removed, e)
+	}
+
+	m.Backups = kept
+	return removed, m.Save(file)
+}
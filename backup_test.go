@@ -0,0 +1,103 @@
+package boltcli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupTo(t *testing.T) {
+	c := newTestDB(t)
+	assert.Nil(t, c.Put([]byte("k"), []byte("v")))
+
+	for _, compression := range []string{CompressNone, CompressGzip} {
+		var buf bytes.Buffer
+		w, err := NewCompressWriter(&buf, compression)
+		assert.Nil(t, err)
+		n, err := c.BackupTo(w)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+		assert.Equal(t, compression, DetectCompression(buf.Bytes()))
+
+		r, err := NewDecompressReader(&buf, compression)
+		assert.Nil(t, err)
+		file := filepath.Join(t.TempDir(), "copy.bolt")
+		f, err := os.Create(file)
+		assert.Nil(t, err)
+		m, err := f.ReadFrom(r)
+		assert.Nil(t, err)
+		assert.Equal(t, n, m)
+		assert.Nil(t, r.Close())
+		assert.Nil(t, f.Close())
+
+		assert.Nil(t, CheckFile(file))
+		copied, err := New(file, WithReadOnly())
+		assert.Nil(t, err)
+		v, err := copied.Get([]byte("k"))
+		assert.Nil(t, err)
+		assert.Equal(t, "v", string(v))
+		assert.Nil(t, copied.Close())
+	}
+}
+
+func TestBackupFile(t *testing.T) {
+	c := newTestDB(t)
+	assert.Nil(t, c.Put([]byte("k"), []byte("v")))
+	dir := t.TempDir()
+
+	e, err := c.BackupFile(dir, CompressGzip)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Ext(e.File), ".gz")
+	assert.Nil(t, VerifyBackup(filepath.Join(dir, e.File), e.SHA256))
+	assert.Equal(t, ErrChecksumMismatch, VerifyBackup(filepath.Join(dir, e.File), "bad"))
+
+	m, err := LoadManifest(ManifestFile(dir, c.DbFile))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(m.Backups))
+	assert.Equal(t, e.SHA256, m.Backups[0].SHA256)
+	assert.Equal(t, e.DataSize, m.Backups[0].DataSize)
+
+	// fake two older backups to prune.
+	older := []BackupEntry{{File: "old0", Time: e.Time.Add(-2 * time.Hour)}, {File: "old1", Time: e.Time.Add(-time.Hour)}}
+	for _, o := range older {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, o.File), nil, 0600))
+	}
+	m.Backups = append(older, m.Backups...)
+	assert.Nil(t, m.Save(ManifestFile(dir, c.DbFile)))
+
+	removed, err := PruneBackups(dir, c.DbFile, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"old0", "old1"}, []string{removed[0].File, removed[1].File})
+	_, err = os.Stat(filepath.Join(dir, "old0"))
+	assert.True(t, os.IsNotExist(err))
+
+	m, err = LoadManifest(ManifestFile(dir, c.DbFile))
+	assert.Nil(t, err)
+	assert.Equal(t, e.File, m.Backups[0].File)
+	assert.Equal(t, 1, len(m.Backups))
+}
+
+func TestBackupFileSameSecond(t *testing.T) {
+	c := newTestDB(t)
+	assert.Nil(t, c.Put([]byte("k"), []byte("v")))
+	dir := t.TempDir()
+
+	names := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		e, err := c.BackupFile(dir, CompressNone)
+		assert.Nil(t, err)
+		names[e.File] = true
+	}
+	assert.Equal(t, 3, len(names))
+
+	m, err := LoadManifest(ManifestFile(dir, c.DbFile))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(m.Backups))
+	for _, e := range m.Backups {
+		assert.Nil(t, VerifyBackup(filepath.Join(dir, e.File), e.SHA256))
+	}
+}
@@ -5,35 +5,88 @@ import (
 	"errors"
 	"fmt"
 	bolt "go.etcd.io/bbolt"
+	"log"
 	"os"
 	"time"
 )
 
-var ErrBucketNotFound = errors.New("bucket not found")
+var (
+	ErrBucketNotFound = errors.New("bucket not found")
+	ErrConflict       = errors.New("value changed meanwhile")
+)
 
 type DB struct {
 	DB     *bolt.DB
 	DbFile string
 	Bucket []byte
+	// Path is the nested bucket path of the key operations, the last element is Bucket.
+	Path [][]byte
+
+	// undoKeep is the number of undo entries to keep, 0 disables the undo log.
+	undoKeep int
+	// undoMaxBucket is the size of the largest bucket deletion recorded in the undo log, see WithUndoMaxBucketSize.
+	undoMaxBucket int64
+
+	// tx is the explicit transaction started by Begin, pending counts the updates made in it.
+	tx      *bolt.Tx
+	pending int
+
+	// journal records the writes when enabled by WithJournal.
+	journal *journal
+	// snapshotWarn is the interval of the warnings about a held snapshot, see WithSnapshotWarn.
+	snapshotWarn time.Duration
+	snapshots    *snapshotSet
+	// user is recorded in the versions of the versioned buckets, see WithUser.
+	user string
 }
 
 type Option struct {
 	DefaultBucket string
+	UndoKeep      int
+	// UndoMaxBucketSize is the size of the largest bucket deletion recorded in the undo log.
+	UndoMaxBucketSize int64
+	// ReadOnly opens the db with a shared lock, so other read only processes can open it too.
+	ReadOnly bool
+	// JournalDir enables the journal of the writes in the dir.
+	JournalDir         string
+	JournalSegmentSize int64
+	// SnapshotWarn is the interval of the warnings about a held snapshot, negative disables them.
+	SnapshotWarn time.Duration
+	// InitialMmapSize is the initial size of the memory map, see WithInitialMmapSize.
+	InitialMmapSize int
+	// User is the author recorded in the versions, the login user by default.
+	User string
 }
 
 type OptionFn func(*Option)
 
 func WithDefaultBucket(v string) OptionFn { return func(o *Option) { o.DefaultBucket = v } }
+func WithReadOnly() OptionFn              { return func(o *Option) { o.ReadOnly = true } }
+
+// WithInitialMmapSize maps size bytes of the db file up front. A write growing the memory map
+// waits for all the read transactions and snapshots, which it does not while the db fits in the map.
+func WithInitialMmapSize(size int) OptionFn { return func(o *Option) { o.InitialMmapSize = size } }
 
 func New(path string, fns ...OptionFn) (*DB, error) {
+	option := createOption(fns)
+
 	// 在当前目录下打开 my.db 这个文件, 如果文件不存在，将会自动创建
-	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		Timeout: 1 * time.Second, ReadOnly: option.ReadOnly, InitialMmapSize: option.InitialMmapSize,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	option := createOption(fns)
-	cli := &DB{DB: db, DbFile: path, Bucket: []byte(option.DefaultBucket)}
+	cli := &DB{DB: db, DbFile: path, undoKeep: option.UndoKeep, undoMaxBucket: option.UndoMaxBucketSize, snapshotWarn: option.SnapshotWarn,
+		snapshots: &snapshotSet{}, user: option.User}
+	cli.WithBucket([]byte(option.DefaultBucket))
+	if option.JournalDir != "" && !option.ReadOnly {
+		if cli.journal, err = openJournal(option.JournalDir, option.JournalSegmentSize); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 
 	return cli, nil
 }
@@ -49,10 +102,38 @@ func createOption(fns []OptionFn) Option {
 		option.DefaultBucket = "default"
 	}
 
+	if option.JournalSegmentSize <= 0 {
+		option.JournalSegmentSize = DefaultJournalSegmentSize
+	}
+
+	if option.UndoMaxBucketSize <= 0 {
+		option.UndoMaxBucketSize = DefaultUndoMaxBucketSize
+	}
+
+	if option.SnapshotWarn == 0 {
+		option.SnapshotWarn = DefaultSnapshotWarn
+	}
+
+	if option.User == "" {
+		option.User = loginUser()
+	}
+
 	return option
 }
 
 func (c *DB) Close() error {
+	if c.tx != nil {
+		_, _ = c.Rollback()
+	}
+
+	c.snapshots.releaseAll()
+	if c.journal != nil {
+		if err := c.journal.close(); err != nil {
+			c.DB.Close()
+			return err
+		}
+	}
+
 	return c.DB.Close()
 }
 
@@ -62,10 +143,10 @@ func (c *DB) Backup(targetPath string) error {
 	})
 }
 
-func (c *DB) Stats(bucket []byte) (bolt.BucketStats, error) {
+func (c *DB) Stats(bucket []byte, nested ...[]byte) (bolt.BucketStats, error) {
 	var stats bolt.BucketStats
-	err := c.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucket)
+	err := c.view(func(tx *bolt.Tx) error {
+		b := bucketAt(tx, append([][]byte{bucket}, nested...))
 		if b == nil {
 			return ErrBucketNotFound
 		}
@@ -77,13 +158,15 @@ func (c *DB) Stats(bucket []byte) (bolt.BucketStats, error) {
 
 func (c *DB) NextSeq() (uint64, error) {
 	var id uint64
-	err := c.DB.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(c.Bucket)
+	err := c.update(func(tx *bolt.Tx) error {
+		b, err := createBucketAt(tx, c.path())
 		if err != nil {
 			return err
 		}
 
-		id, err = b.NextSequence()
+		if id, err = b.NextSequence(); err == nil {
+			c.journalAdd(JournalRecord{Op: OpSetSeq, Path: c.path(), Seq: id})
+		}
 		return err
 	})
 
@@ -92,8 +175,8 @@ func (c *DB) NextSeq() (uint64, error) {
 
 func (c *DB) Seq() (uint64, error) {
 	var id uint64
-	err := c.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(c.Bucket)
+	err := c.view(func(tx *bolt.Tx) error {
+		b := bucketAt(tx, c.path())
 		if b == nil {
 			return ErrBucketNotFound
 		}
@@ -106,20 +189,30 @@ func (c *DB) Seq() (uint64, error) {
 }
 
 func (c *DB) SetSeq(num uint64) error {
-	return c.DB.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(c.Bucket)
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := createBucketAt(tx, c.path())
 		if err != nil {
 			return err
 		}
 
-		return b.SetSequence(num)
+		return c.setSeq(tx, b, num)
 	})
 }
 
+// setSeq sets the sequence of b with the undo and journal records.
+func (c *DB) setSeq(tx *bolt.Tx, b *bolt.Bucket, num uint64) error {
+	if err := c.recordUndo(tx, &UndoEntry{Op: OpSetSeq, Path: c.path(), Seq: b.Sequence()}); err != nil {
+		return err
+	}
+
+	c.journalAdd(JournalRecord{Op: OpSetSeq, Path: c.path(), Seq: num})
+	return b.SetSequence(num)
+}
+
 func (c *DB) Get(key []byte) ([]byte, error) {
 	var ret []byte
-	err := c.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(c.Bucket)
+	err := c.view(func(tx *bolt.Tx) error {
+		b := bucketAt(tx, c.path())
 		if b == nil {
 			return ErrBucketNotFound
 		}
@@ -130,24 +223,80 @@ func (c *DB) Get(key []byte) ([]byte, error) {
 	return ret, err
 }
 
+// Lookup gets the value of the key like Get, but returns ErrKeyNotFound for a missing key.
+func (c *DB) Lookup(key []byte) ([]byte, error) {
+	var ret []byte
+	err := c.view(func(tx *bolt.Tx) error {
+		b := bucketAt(tx, c.path())
+		if b == nil {
+			return ErrBucketNotFound
+		}
+
+		v := b.Get(key)
+		if v == nil {
+			return ErrKeyNotFound
+		}
+
+		ret = CloneBytes(v)
+		return nil
+	})
+
+	return ret, err
+}
+
 func (c *DB) Put(key, value []byte, more ...[]byte) error {
-	return c.DB.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(c.Bucket)
+	items := []KeyValue{{Key: key, Value: value}}
+	for i := 0; i+1 < len(more); i += 2 {
+		items = append(items, KeyValue{Key: more[i], Value: more[i+1]})
+	}
+
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := createBucketAt(tx, c.path())
 		if err != nil {
 			return err
 		}
 
-		if err := b.Put(key, value); err != nil {
+		return c.put(tx, b, items)
+	})
+}
+
+// put writes the items into b with the undo, version and journal records.
+func (c *DB) put(tx *bolt.Tx, b *bolt.Bucket, items []KeyValue) error {
+	keys := make([][]byte, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	if err := c.recordKeys(tx, OpPut, b, keys...); err != nil {
+		return err
+	}
+	if err := c.recordVersions(tx, b, OpPut, items); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := b.Put(item.Key, item.Value); err != nil {
 			return err
 		}
+	}
 
-		for i := 0; i+1 < len(more); i += 2 {
-			if err := b.Put(more[i], more[i+1]); err != nil {
-				return err
-			}
+	c.journalAdd(JournalRecord{Op: OpPut, Path: c.path(), Items: items})
+	return nil
+}
+
+// CompareAndPut puts the value only if the key still has the old value, it returns ErrConflict otherwise.
+// Like Get, an empty old value matches both an empty value and a missing key.
+func (c *DB) CompareAndPut(key, old, value []byte) error {
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := createBucketAt(tx, c.path())
+		if err != nil {
+			return err
 		}
 
-		return nil
+		if !bytes.Equal(b.Get(key), old) {
+			return ErrConflict
+		}
+
+		return c.put(tx, b, []KeyValue{{Key: key, Value: value}})
 	})
 }
 
@@ -159,9 +308,11 @@ func CloneBytes(b []byte) []byte {
 
 func (c *DB) GetBuckets() ([][]byte, error) {
 	var ret [][]byte
-	err := c.DB.View(func(tx *bolt.Tx) error {
+	err := c.view(func(tx *bolt.Tx) error {
 		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
-			ret = append(ret, CloneBytes(name))
+			if !IsHiddenBucket(name) {
+				ret = append(ret, CloneBytes(name))
+			}
 			return nil
 		})
 	})
@@ -169,36 +320,135 @@ func (c *DB) GetBuckets() ([][]byte, error) {
 	return ret, err
 }
 
-func (c *DB) NewBucket(bucket []byte) error {
-	return c.DB.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(bucket)
+// NewBucket creates the bucket, or the nested bucket bucket/nested... with all its parents.
+func (c *DB) NewBucket(bucket []byte, nested ...[]byte) error {
+	path := append([][]byte{bucket}, nested...)
+	return c.update(func(tx *bolt.Tx) error {
+		c.journalAdd(JournalRecord{Op: OpNewBucket, Path: path})
+		_, err := createBucketAt(tx, path)
 		return err
 	})
 }
 
-func (c *DB) DelBucket(bucket []byte) error {
-	return c.DB.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket(bucket) })
+// DelBucket deletes the bucket, or the nested bucket bucket/nested....
+func (c *DB) DelBucket(bucket []byte, nested ...[]byte) error {
+	path := append([][]byte{bucket}, nested...)
+	return c.update(func(tx *bolt.Tx) error {
+		if c.undoKeep > 0 {
+			if b := bucketAt(tx, path); b != nil {
+				// a large bucket is deleted without an undo entry, which would hold it all in memory and in one value.
+				if node, ok := readBucketNodeMax(path[len(path)-1], b, c.undoMaxBucket); ok {
+					if err := c.recordUndo(tx, &UndoEntry{Op: OpDelBucket, Path: path, Bucket: node}); err != nil {
+						return err
+					}
+				} else {
+					log.Printf("WARN: bucket %s of more than %d bytes deleted without an undo entry", FormatPath(path), c.undoMaxBucket)
+				}
+			}
+		}
+
+		if err := c.dropVersions(tx, path); err != nil {
+			return err
+		}
+
+		c.journalAdd(JournalRecord{Op: OpDelBucket, Path: path})
+		if len(nested) == 0 {
+			return tx.DeleteBucket(bucket)
+		}
+
+		parent := bucketAt(tx, path[:len(path)-1])
+		if parent == nil {
+			return ErrBucketNotFound
+		}
+
+		return parent.DeleteBucket(nested[len(nested)-1])
+	})
 }
 
 func (c *DB) WithBucket(bucket []byte) *DB {
-	c.Bucket = bucket
+	return c.WithPath(bucket)
+}
+
+// WithPath switches to the nested bucket path, an empty path means the root.
+func (c *DB) WithPath(path ...[]byte) *DB {
+	c.Path = path
+	c.Bucket = nil
+	if len(path) > 0 {
+		c.Bucket = path[len(path)-1]
+	}
+
 	return c
 }
 
+func (c *DB) path() [][]byte {
+	if len(c.Path) > 0 || len(c.Bucket) == 0 {
+		return c.Path
+	}
+
+	return [][]byte{c.Bucket}
+}
+
+// bucketAt returns the nested bucket of path, or nil if it does not exist.
+func bucketAt(tx *bolt.Tx, path [][]byte) *bolt.Bucket {
+	if len(path) == 0 {
+		return nil
+	}
+
+	b := tx.Bucket(path[0])
+	for _, name := range path[1:] {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket(name)
+	}
+
+	return b
+}
+
+// createBucketAt returns the nested bucket of path, creating the missing ones.
+func createBucketAt(tx *bolt.Tx, path [][]byte) (*bolt.Bucket, error) {
+	if len(path) == 0 {
+		return nil, bolt.ErrBucketNameRequired
+	}
+
+	b, err := tx.CreateBucketIfNotExists(path[0])
+	for _, name := range path[1:] {
+		if err != nil {
+			return nil, err
+		}
+		b, err = b.CreateBucketIfNotExists(name)
+	}
+
+	return b, err
+}
+
 func (c *DB) Del(key []byte) (err error) {
-	return c.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(c.Bucket)
+	return c.update(func(tx *bolt.Tx) error {
+		b := bucketAt(tx, c.path())
 		if b == nil {
 			return ErrBucketNotFound
 		}
 
-		return b.Delete(key)
+		return c.del(tx, b, key)
 	})
 }
 
+// del deletes the key from b with the undo, version and journal records.
+func (c *DB) del(tx *bolt.Tx, b *bolt.Bucket, key []byte) error {
+	if err := c.recordKeys(tx, OpDel, b, key); err != nil {
+		return err
+	}
+	if err := c.recordVersions(tx, b, OpDel, []KeyValue{{Key: key}}); err != nil {
+		return err
+	}
+
+	c.journalAdd(JournalRecord{Op: OpDel, Path: c.path(), Keys: [][]byte{key}})
+	return b.Delete(key)
+}
+
 func (c *DB) Range(min, max []byte, f func(index int, k, v []byte) bool) (err error) {
-	return c.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(c.Bucket)
+	return c.view(func(tx *bolt.Tx) error {
+		b := bucketAt(tx, c.path())
 		// 如果 bucket 返回为 nil，则说明不存在对应 bucket
 		if b == nil {
 			return fmt.Errorf("bucket %s is not found", c.Bucket)
@@ -217,8 +467,8 @@ func (c *DB) Range(min, max []byte, f func(index int, k, v []byte) bool) (err er
 	})
 }
 func (c *DB) PrefixList(prefix []byte, f func(index int, k, v []byte) bool) (err error) {
-	return c.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(c.Bucket)
+	return c.view(func(tx *bolt.Tx) error {
+		b := bucketAt(tx, c.path())
 		if b == nil {
 			return fmt.Errorf("bucket %s is not found", c.Bucket)
 		}
@@ -266,8 +516,8 @@ func bucketScan(i *int, parent []byte, b *bolt.Bucket, tx *bolt.Tx, f func(index
 func (c *DB) List(f func(index int, key, val []byte) bool) error {
 	i := 0
 
-	return c.DB.View(func(tx *bolt.Tx) error {
-		return bucketScan(&i, nil, tx.Bucket(c.Bucket), tx, f)
+	return c.view(func(tx *bolt.Tx) error {
+		return bucketScan(&i, nil, bucketAt(tx, c.path()), tx, f)
 	})
 }
 
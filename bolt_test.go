@@ -2,6 +2,7 @@ package boltcli
 
 import (
 	"github.com/stretchr/testify/assert"
+	"path/filepath"
 	"testing"
 )
 
@@ -23,3 +24,39 @@ func Test_BoltCli(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "huang", string(v))
 }
+
+func newTestDB(t *testing.T, fns ...OptionFn) *DB {
+	c, err := New(filepath.Join(t.TempDir(), "test.bolt"), fns...)
+	assert.Nil(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestCompareAndPut(t *testing.T) {
+	c := newTestDB(t)
+
+	assert.Nil(t, c.CompareAndPut([]byte("name"), nil, []byte("bingoo")))
+	assert.Equal(t, ErrConflict, c.CompareAndPut([]byte("name"), []byte{}, []byte("huang")))
+	assert.Equal(t, ErrConflict, c.CompareAndPut([]byte("name"), []byte("huang"), []byte("huang")))
+	assert.Nil(t, c.CompareAndPut([]byte("name"), []byte("bingoo"), []byte("huang")))
+
+	v, err := c.Get([]byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, "huang", string(v))
+}
+
+func TestLookup(t *testing.T) {
+	c := newTestDB(t)
+
+	_, err := c.Lookup([]byte("name"))
+	assert.Equal(t, ErrBucketNotFound, err)
+
+	assert.Nil(t, c.Put([]byte("name"), []byte{}))
+	v, err := c.Lookup([]byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{}, v)
+
+	_, err = c.Lookup([]byte("age"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
@@ -0,0 +1,308 @@
+// Package client calls the JSON API of boltweb, see /api/openapi.json of a running boltweb.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Error is an error reply of the API.
+type Error struct {
+	// Status is the HTTP status, Code one of the codes like bucket_not_found.
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message) }
+
+// IsNotFound tells whether err is a reply about a missing bucket or key.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Status == http.StatusNotFound
+}
+
+// Bucket is a bucket with its direct nested buckets and the number of its keys.
+type Bucket struct {
+	Path    string   `json:"path"`
+	Buckets []string `json:"buckets"`
+	KeyN    int      `json:"keyN"`
+	Seq     uint64   `json:"seq"`
+}
+
+// TreeNode is a bucket in the tree of the nested buckets, Truncated tells it has nested buckets below the depth.
+type TreeNode struct {
+	Name      string      `json:"name"`
+	Path      string      `json:"path"`
+	KeyN      int         `json:"keyN"`
+	Buckets   []*TreeNode `json:"buckets"`
+	Truncated bool        `json:"truncated"`
+}
+
+// KeyValue is a key with its value and the content type detected by the server.
+// Truncated tells Value is only the first bytes of the value, in the key lists.
+type KeyValue struct {
+	Key         string
+	Value       []byte
+	ContentType string
+	Size        int
+	Truncated   bool
+}
+
+// keyView is the binary safe KeyValue of the API.
+type keyView struct {
+	Key         string `json:"key"`
+	KeyBase64   []byte `json:"keyBase64"`
+	Base64      []byte `json:"base64"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+	Truncated   bool   `json:"truncated"`
+}
+
+func (v keyView) keyValue() KeyValue {
+	kv := KeyValue{Key: v.Key, Value: v.Base64, ContentType: v.ContentType, Size: v.Size, Truncated: v.Truncated}
+	if v.KeyBase64 != nil {
+		kv.Key = string(v.KeyBase64)
+	}
+
+	return kv
+}
+
+// Client calls the API of the boltweb at BaseURL like http://localhost:8080.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// New returns a client of the boltweb at baseURL using http.DefaultClient.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTP: http.DefaultClient}
+}
+
+// Buckets lists the top level buckets.
+func (c *Client) Buckets(ctx context.Context) ([]string, error) {
+	var reply struct {
+		Buckets []string `json:"buckets"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/v1/buckets", nil, &reply)
+	return reply.Buckets, err
+}
+
+// Bucket shows the nested bucket of path.
+func (c *Client) Bucket(ctx context.Context, path ...string) (*Bucket, error) {
+	var b Bucket
+	if err := c.do(ctx, http.MethodGet, bucketURL(path), nil, &b); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// Tree returns the tree of the nested buckets below path down to depth levels, 0 for all.
+// The names of path cannot contain a /.
+func (c *Client) Tree(ctx context.Context, depth int, path ...string) (*TreeNode, error) {
+	q := url.Values{}
+	q.Set("path", strings.Join(path, "/"))
+	q.Set("depth", strconv.Itoa(depth))
+
+	var n TreeNode
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tree?"+q.Encode(), nil, &n); err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+// CreateBucket creates the nested bucket of path with its missing parents.
+func (c *Client) CreateBucket(ctx context.Context, path ...string) error {
+	return c.do(ctx, http.MethodPut, bucketURL(path), nil, nil)
+}
+
+// DeleteBucket deletes the nested bucket of path.
+func (c *Client) DeleteBucket(ctx context.Context, path ...string) error {
+	return c.do(ctx, http.MethodDelete, bucketURL(path), nil, nil)
+}
+
+// Keys lists up to limit keys with the prefix in the bucket of path, limit 0 uses the server default.
+// The long values are truncated, see KeyValue.
+func (c *Client) Keys(ctx context.Context, path []string, prefix string, limit int) ([]KeyValue, error) {
+	q := url.Values{}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	u := bucketURL(path) + "/keys"
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	var reply struct {
+		Keys []keyView `json:"keys"`
+	}
+	if err := c.do(ctx, http.MethodGet, u, nil, &reply); err != nil {
+		return nil, err
+	}
+
+	kvs := make([]KeyValue, len(reply.Keys))
+	for i, v := range reply.Keys {
+		kvs[i] = v.keyValue()
+	}
+
+	return kvs, nil
+}
+
+// Get gets the value of the key in the bucket of path.
+func (c *Client) Get(ctx context.Context, path []string, key string) ([]byte, error) {
+	var v keyView
+	if err := c.do(ctx, http.MethodGet, keyURL(path, key), nil, &v); err != nil {
+		return nil, err
+	}
+
+	return v.Base64, nil
+}
+
+// Put puts the value of the key in the bucket of path, creating the missing buckets.
+func (c *Client) Put(ctx context.Context, path []string, key string, value []byte) error {
+	return c.do(ctx, http.MethodPut, keyURL(path, key), value, nil)
+}
+
+// Delete deletes the key in the bucket of path.
+func (c *Client) Delete(ctx context.Context, path []string, key string) error {
+	return c.do(ctx, http.MethodDelete, keyURL(path, key), nil, nil)
+}
+
+// bucketURL escapes the names of path, a bucket named keys included.
+func bucketURL(path []string) string {
+	var b strings.Builder
+	b.WriteString("/api/v1/buckets")
+	for _, name := range path {
+		b.WriteByte('/')
+		if name == "keys" {
+			b.WriteString("%6Beys")
+		} else {
+			b.WriteString(url.PathEscape(name))
+		}
+	}
+
+	return b.String()
+}
+
+func keyURL(path []string, key string) string {
+	return bucketURL(path) + "/keys/" + url.PathEscape(key)
+}
+
+// ImportResult tells what an import changed, or would change with the dry run.
+type ImportResult struct {
+	Bucket    string `json:"bucket"`
+	Format    string `json:"format"`
+	Mode      string `json:"mode"`
+	DryRun    bool   `json:"dryRun"`
+	Records   int    `json:"records"`
+	Added     int    `json:"added"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+	Deleted   int    `json:"deleted"`
+	// Changes lists the first changes.
+	Changes []struct {
+		Op     string `json:"op"`
+		Bucket string `json:"bucket"`
+		Key    string `json:"key"`
+	} `json:"changes"`
+}
+
+// Export writes the keys of the bucket of path and of its nested buckets to w in the format
+// ndjson, json or csv, all the buckets with an empty path. The names of path cannot contain a /.
+func (c *Client) Export(ctx context.Context, w io.Writer, format string, path ...string) error {
+	q := url.Values{}
+	q.Set("bucket", strings.Join(path, "/"))
+	q.Set("format", format)
+
+	rsp, err := c.send(ctx, http.MethodGet, "/api/v1/export?"+q.Encode(), nil, "")
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	_, err = io.Copy(w, rsp.Body)
+	return err
+}
+
+// Import imports the records of r in the format into the bucket of path, with the mode merge or replace.
+// The dry run only tells what would change.
+func (c *Client) Import(ctx context.Context, r io.Reader, format, mode string, dryRun bool, path ...string) (*ImportResult, error) {
+	q := url.Values{}
+	q.Set("bucket", strings.Join(path, "/"))
+	q.Set("format", format)
+	q.Set("mode", mode)
+	q.Set("dryRun", strconv.FormatBool(dryRun))
+
+	rsp, err := c.send(ctx, http.MethodPost, "/api/v1/import?"+q.Encode(), r, "application/octet-stream")
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	var result ImportResult
+	return &result, json.NewDecoder(rsp.Body).Decode(&result)
+}
+
+// do sends the request and decodes the JSON reply into out when not nil.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	rsp, err := c.send(ctx, method, path, r, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(rsp.Body).Decode(out)
+}
+
+// send sends the request with the body of the content type when not nil, the error replies are returned as *Error.
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rsp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode >= 400 {
+		defer rsp.Body.Close()
+		var reply struct {
+			Error *Error `json:"error"`
+		}
+		if err := json.NewDecoder(rsp.Body).Decode(&reply); err != nil || reply.Error == nil {
+			return nil, &Error{Status: rsp.StatusCode, Code: "http", Message: rsp.Status}
+		}
+
+		reply.Error.Status = rsp.StatusCode
+		return nil, reply.Error
+	}
+
+	return rsp, nil
+}
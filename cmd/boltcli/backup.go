@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/urfave/cli/v2"
+)
+
+// dbOptions are the options of the db opened for the data commands.
+func dbOptions() []boltcli.OptionFn {
+	fns := []boltcli.OptionFn{boltcli.WithUndo(undoKeep)}
+	if journal {
+		fns = append(fns, boltcli.WithJournal(boltcli.JournalDir(dbfile)))
+	}
+
+	return fns
+}
+
+func compressionFlag(c *cli.Context) string {
+	if compression := c.String("compress"); compression != "none" {
+		return compression
+	}
+
+	return boltcli.CompressNone
+}
+
+func dbBackup(c *cli.Context) error {
+	if !boltcli.IsFileExist(dbfile) {
+		return cli.Exit("Db file is not exists: "+dbfile, 1)
+	}
+
+	if out := c.String("out"); out != "" {
+		return backupTo(out, compressionFlag(c))
+	}
+
+	dir := c.String("dir")
+	if dir == "" {
+		dir = filepath.Dir(dbfile)
+	}
+
+	backup := func() error { return backupOnce(dir, compressionFlag(c), c.Int("keep")) }
+	if c.Bool("incremental") {
+		backup = func() error { return backupIncremental(dir, compressionFlag(c)) }
+	}
+
+	every := c.Duration("every")
+	if every <= 0 {
+		if err := backup(); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		return nil
+	}
+
+	log.Printf("backup %s into %s every %s", dbfile, dir, every)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		// a failed backup is retried on the next tick.
+		if err := backup(); err != nil {
+			log.Print(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case sig := <-signals:
+			log.Printf("backup stopped by %s", sig)
+			return nil
+		}
+	}
+}
+
+// backupOnce opens the db read only for each backup, so it does not block the other readers in between.
+// The read only open still waits for the shared file lock, so it fails by the timeout while another
+// process holds the db open for writing, such a db is backed up by its owning process with BackupFile.
+func backupOnce(dir, compression string, keep int) error {
+	cmd, err := boltcli.New(dbfile, boltcli.WithReadOnly())
+	if err != nil {
+		return fmt.Errorf("new boltcli err %w", err)
+	}
+
+	e, err := cmd.BackupFile(dir, compression)
+	cmd.Close()
+	if err != nil {
+		return fmt.Errorf("Backup err %w", err)
+	}
+
+	log.Printf("Backup ok: %s, %d bytes, sha256 %s", filepath.Join(dir, e.File), e.Size, e.SHA256)
+
+	// the journal up to the full backup is no longer needed by the increments.
+	if journalDir := boltcli.JournalDir(dbfile); boltcli.IsFileExist(journalDir) {
+		removed, err := boltcli.PruneJournal(journalDir, e.TxID)
+		if err != nil {
+			return fmt.Errorf("Prune journal err %w", err)
+		}
+		for _, r := range removed {
+			log.Printf("Pruned %s", r)
+		}
+	}
+
+	if keep > 0 {
+		removed, err := boltcli.PruneBackups(dir, dbfile, keep)
+		if err != nil {
+			return fmt.Errorf("Prune err %w", err)
+		}
+		for _, r := range removed {
+			log.Printf("Pruned %s", filepath.Join(dir, r.File))
+		}
+	}
+
+	return nil
+}
+
+func backupIncremental(dir, compression string) error {
+	e, err := boltcli.BackupIncremental(dir, dbfile, boltcli.JournalDir(dbfile), compression)
+	if errors.Is(err, boltcli.ErrNoChanges) {
+		log.Print(err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Backup err %w", err)
+	}
+
+	log.Printf("Backup ok: %s, up to tx %d of %s, %d bytes, sha256 %s",
+		filepath.Join(dir, e.File), e.TxID, e.Base, e.Size, e.SHA256)
+	return nil
+}
+
+// backupTo streams the backup into the out file, - for stdout.
+func backupTo(out, compression string) error {
+	cmd, err := boltcli.New(dbfile, boltcli.WithReadOnly())
+	if err != nil {
+		return cli.Exit("new boltcli err "+err.Error(), 1)
+	}
+	defer cmd.Close()
+
+	var w io.WriteCloser = os.Stdout
+	if out != "-" {
+		if w, err = os.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600); err != nil {
+			return cli.Exit("Backup err "+err.Error(), 1)
+		}
+		defer w.Close()
+	}
+
+	cw, err := boltcli.NewCompressWriter(w, compression)
+	if err != nil {
+		return cli.Exit("Backup err "+err.Error(), 1)
+	}
+
+	if _, err := cmd.BackupTo(cw); err != nil {
+		return cli.Exit("Backup err "+err.Error(), 1)
+	}
+
+	if err := cw.Close(); err != nil {
+		return cli.Exit("Backup err "+err.Error(), 1)
+	}
+
+	return nil
+}
+
+// trailingFlags sets the flags given after the first argument, where urfave/cli stops parsing them.
+func trailingFlags(c *cli.Context) error {
+	args := c.Args().Tail()
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		if name == args[i] {
+			return fmt.Errorf("unexpected argument %s", args[i])
+		}
+
+		value := "true"
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value = name[:j], name[j+1:]
+		} else if !isBoolFlag(c.Command, name) {
+			if i+1 == len(args) {
+				return fmt.Errorf("flag %s needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+
+		if err := c.Set(name, value); err != nil {
+			return fmt.Errorf("flag %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func isBoolFlag(cmd *cli.Command, name string) bool {
+	for _, f := range cmd.Flags {
+		if _, ok := f.(*cli.BoolFlag); ok {
+			for _, n := range f.Names() {
+				if n == name {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func dbRestore(c *cli.Context) error {
+	backup := c.Args().First()
+	if backup == "" {
+		return cli.Exit("need the backup file", 1)
+	}
+
+	if err := trailingFlags(c); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	to := c.String("to")
+	if to == "" {
+		to = dbfile
+	}
+
+	opt := boltcli.RestoreOption{Checksum: c.String("sha256"), KeepPrev: c.Bool("keep-prev"), Increments: c.Bool("incremental")}
+	if until := c.String("until"); until != "" {
+		t, err := parseTime(until)
+		if err != nil {
+			return cli.Exit("bad --until "+err.Error(), 1)
+		}
+		opt.Until, opt.Increments = t, true
+	}
+
+	if err := boltcli.Restore(backup, to, opt); err != nil {
+		return cli.Exit("Restore err "+err.Error(), 1)
+	}
+
+	fmt.Println("Restored " + backup + " to " + to)
+	if opt.KeepPrev && boltcli.IsFileExist(to+boltcli.PrevSuffix) {
+		fmt.Println("Previous db kept as " + to + boltcli.PrevSuffix)
+	}
+
+	return nil
+}
+
+// parseTime parses a local time like 2006-01-02 15:04:05, with optional seconds, or an RFC3339 time.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
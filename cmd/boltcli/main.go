@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/bingoohuang/boltcli"
+	"github.com/bingoohuang/boltcli/internal/console"
+	"github.com/bingoohuang/boltcli/internal/zstd"
+	"io"
 	"os"
 	"sort"
 	"time"
@@ -12,8 +18,13 @@ import (
 
 var dbfile string
 var bucket string
+var undoKeep int
+
+var journal bool
 
 func main() {
+	zstd.Register()
+
 	app := &cli.App{
 		Name:                 "boltcli",               // 应用名称
 		Usage:                "a cli for boltdb file", // 应用功能说明
@@ -33,14 +44,58 @@ func main() {
 			Destination: &dbfile, Aliases: []string{"f"}},
 		&cli.StringFlag{Name: "bucket, b", Usage: "Specify `BUCKET` name.", Value: "default",
 			Destination: &bucket, Aliases: []string{"b"}},
+		&cli.IntFlag{Name: "undo-keep", Usage: "Number of destructive commands kept for undo like 100, 0 disables undo",
+			Destination: &undoKeep},
+		&cli.BoolFlag{Name: "journal", Usage: "Append the writes to the journal FILE.journal for incremental backups", Destination: &journal},
 	}
 	app.Commands = []*cli.Command{
 		{Name: "get", Aliases: []string{"g"}, Category: "data", Usage: "Get value from a key in the `BUCKET`", Action: dbGet,
 			Flags: []cli.Flag{&cli.BoolFlag{Name: "forever", Aliases: []string{"forevvarr"}}}},
+		{Name: "view", Aliases: []string{"v"}, Category: "data", Usage: "Pretty print a value by its detected codec.", Action: dbView},
+		{Name: "edit", Aliases: []string{"e"}, Category: "data", Usage: "Edit a value in $EDITOR and write it back on save.", Action: dbEdit},
 		{Name: "list", Aliases: []string{"ls"}, Category: "data", Usage: "List all data in the `BUCKET`.", Action: dbList},
 		{Name: "set", Aliases: []string{"s"}, Category: "data", Usage: "Set value by a key in the `BUCKET`.", Action: dbSet},
+		{Name: "delete", Aliases: []string{"d"}, Category: "data", Usage: "Delete a key in the `BUCKET`.", Action: dbDelete},
+		{Name: "undo", Category: "data", Usage: "Undo the latest destructive command.", Action: dbUndo,
+			Flags: []cli.Flag{&cli.BoolFlag{Name: "list", Aliases: []string{"l"}, Usage: "List the undo log instead"}}},
+		{Name: "info", Category: "database", Usage: "Show file level stats of the db with the largest buckets and keys.", Action: dbInfo,
+			Flags: []cli.Flag{
+				&cli.IntFlag{Name: "top", Value: 10, Usage: "Number of the largest buckets and keys to show"},
+				&cli.BoolFlag{Name: "json", Usage: "Output as JSON"},
+			}},
+		{Name: "analyze", Category: "database", Usage: "Analyze the key and value sizes and the key prefixes of the `BUCKET`, a nested bucket like a/b.", Action: dbAnalyze,
+			Flags: []cli.Flag{
+				&cli.IntFlag{Name: "top", Value: 10, Usage: "Number of the largest keys, and of the prefixes per level"},
+				&cli.IntFlag{Name: "depth", Value: 2, Usage: "Number of key segments of the prefix rollup"},
+				&cli.StringFlag{Name: "separators", Value: boltcli.DefaultSeparators, Usage: "Bytes ending a key segment"},
+				&cli.BoolFlag{Name: "json", Usage: "Output as JSON"},
+			}},
+		{Name: "backup", Aliases: []string{"bak"}, Category: "database", Usage: "Back up the db, checked and recorded with its checksum in the manifest of the dir.", Action: dbBackup,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "dir", Usage: "Backup `DIR`, default the dir of the db"},
+				&cli.IntFlag{Name: "keep", Usage: "Number of the newest backups to keep, 0 keeps all"},
+				&cli.DurationFlag{Name: "every", Usage: "Back up every `INTERVAL` like 1h until interrupted, 0 backs up once. " +
+					"Each backup opens the db read only, which fails while another process has it open for writing"},
+				&cli.StringFlag{Name: "compress", Value: boltcli.CompressGzip, Usage: "Compression gzip, zstd or none"},
+				&cli.StringFlag{Name: "out", Aliases: []string{"o"}, Usage: "Stream the backup to `FILE` instead, - for stdout, without check and manifest"},
+				&cli.BoolFlag{Name: "incremental", Usage: "Back up the journal since the previous backup of the latest full backup instead"},
+			}},
+		{Name: "restore", Category: "database", Usage: "Restore a checked backup, e.g. restore backup.bak.gz --to db.bolt", Action: dbRestore,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "to", Usage: "Target db `FILE`, default the -f file"},
+				&cli.BoolFlag{Name: "keep-prev", Usage: "Keep the replaced db as FILE.prev"},
+				&cli.StringFlag{Name: "sha256", Usage: "Expected checksum of the backup, default the one in the manifest next to it"},
+				&cli.BoolFlag{Name: "incremental", Usage: "Replay the incremental backups of the full backup in the manifest next to it"},
+				&cli.StringFlag{Name: "until", Usage: "Replay the increments up to `TIME` like 2006-01-02 15:04:05, implies --incremental"},
+			}},
+		{Name: "pages", Category: "pages", Usage: "List the pages of the db file with a utilization histogram.", Action: pagesList,
+			Flags: []cli.Flag{&cli.StringFlag{Name: "bucket", Usage: "Show the B+tree pages of the nested `BUCKET` like a/b instead, / for the root"}}},
+		{Name: "page", Category: "pages", Usage: "Show a page and its elements, e.g. page 3", Action: pageShow},
+		{Name: "freelist", Category: "pages", Usage: "List the free pages of the db file.", Action: freelistShow},
 		{Name: "bucket.list", Aliases: []string{"bl"}, Category: "bucket", Usage: "List all buckets in the db.", Action: bucketList},
 		{Name: "bucket.new", Aliases: []string{"bn"}, Category: "bucket", Usage: "Create a new bucket. boltcli -f test.db nb newbucket", Action: dbNewBucket},
+		{Name: "bucket.del", Aliases: []string{"bd"}, Category: "bucket", Usage: "Delete a bucket after confirmation.", Action: dbDelBucket,
+			Flags: []cli.Flag{&cli.BoolFlag{Name: "yes", Aliases: []string{"y"}, Usage: "Delete without confirmation"}}},
 	}
 
 	sort.Sort(cli.FlagsByName(app.Flags))
@@ -62,7 +117,7 @@ func dbGet(c *cli.Context) error {
 		return cli.Exit("need key", 1)
 	}
 
-	cmd, err := boltcli.New(dbfile)
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
 	if err != nil {
 		return cli.Exit("new boltcli err "+err.Error(), 1)
 	}
@@ -83,15 +138,17 @@ func dbList(c *cli.Context) error {
 		return cli.Exit("Db file is not exists: "+dbfile, 1)
 	}
 
-	cmd, err := boltcli.New(dbfile)
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
 	if err != nil {
 		return cli.Exit("new boltcli err "+err.Error(), 1)
 	}
 	defer cmd.Close()
 
-	err = cmd.WithBucket([]byte(bucket)).List(func(index int, key, val []byte) bool {
-		fmt.Printf("%s\t : %s\n", key, val)
-		return true
+	err = console.Page(func(w io.Writer) error {
+		return cmd.WithBucket([]byte(bucket)).List(func(index int, key, val []byte) bool {
+			fmt.Fprintf(w, "%s\t : %s\n", key, val)
+			return true
+		})
 	})
 	if err != nil {
 		return cli.Exit("list bucket err "+err.Error(), 1)
@@ -100,12 +157,93 @@ func dbList(c *cli.Context) error {
 	return nil
 }
 
+func dbView(c *cli.Context) error {
+	if !boltcli.IsFileExist(dbfile) {
+		return cli.Exit("Db file is not exists: "+dbfile, 1)
+	}
+
+	key := c.Args().First()
+	if len(key) == 0 {
+		return cli.Exit("need key", 1)
+	}
+
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
+	if err != nil {
+		return cli.Exit("new boltcli err "+err.Error(), 1)
+	}
+	defer cmd.Close()
+
+	v, err := cmd.WithBucket([]byte(bucket)).Get([]byte(key))
+	if err != nil {
+		return cli.Exit("get key err "+err.Error(), 1)
+	}
+
+	_ = console.Page(func(w io.Writer) error {
+		fmt.Fprintf(w, "%s.%s (%s, %d bytes)\n", bucket, key, boltcli.DetectCodec(v), len(v))
+		fmt.Fprintln(w, boltcli.Pretty(v))
+		return nil
+	})
+
+	return nil
+}
+
+// dbEdit keeps the db closed while the editor is open, so that other processes
+// can write meanwhile, such a change is detected as a conflict on save.
+func dbEdit(c *cli.Context) error {
+	key := c.Args().First()
+	if len(key) == 0 {
+		return cli.Exit("need key", 1)
+	}
+
+	old, err := editGet([]byte(key))
+	if err != nil && !errors.Is(err, boltcli.ErrBucketNotFound) {
+		return cli.Exit("get key err "+err.Error(), 1)
+	}
+
+	suffix := ".txt"
+	if boltcli.DetectCodec(old) == boltcli.CodecJSON {
+		suffix = ".json"
+	}
+
+	v, err := console.Edit(old, suffix)
+	if err != nil {
+		return cli.Exit("edit err "+err.Error(), 1)
+	}
+
+	if bytes.Equal(v, old) {
+		fmt.Println("No changes.")
+		return nil
+	}
+
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
+	if err != nil {
+		return cli.Exit("new boltcli err "+err.Error(), 1)
+	}
+	defer cmd.Close()
+
+	if err := cmd.WithBucket([]byte(bucket)).CompareAndPut([]byte(key), old, v); err != nil {
+		return cli.Exit("Set err "+err.Error(), 1)
+	}
+
+	return nil
+}
+
+func editGet(key []byte) ([]byte, error) {
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	defer cmd.Close()
+
+	return cmd.WithBucket([]byte(bucket)).Get(key)
+}
+
 func dbSet(c *cli.Context) error {
 	key := c.Args().First()
 	value := c.Args().Get(1)
 	fmt.Println(key, value)
 
-	cmd, err := boltcli.New(dbfile)
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
 	if err != nil {
 		return cli.Exit("new boltcli err "+err.Error(), 1)
 	}
@@ -123,7 +261,7 @@ func bucketList(c *cli.Context) error {
 		return cli.Exit("Db file is not exists: "+dbfile, 1)
 	}
 
-	cmd, err := boltcli.New(dbfile)
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
 	if err != nil {
 		return cli.Exit("new boltcli err "+err.Error(), 1)
 	}
@@ -151,7 +289,7 @@ func dbNewBucket(c *cli.Context) error {
 		return cli.Exit("NewBucket err, need bucket name.", 1)
 	}
 
-	cmd, err := boltcli.New(dbfile)
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
 	if err != nil {
 		return cli.Exit("new boltcli err "+err.Error(), 1)
 	}
@@ -165,3 +303,145 @@ func dbNewBucket(c *cli.Context) error {
 	fmt.Println("Bucket created: " + bucket)
 	return nil
 }
+
+func dbDelete(c *cli.Context) error {
+	key := c.Args().First()
+	if len(key) == 0 {
+		return cli.Exit("need key", 1)
+	}
+
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
+	if err != nil {
+		return cli.Exit("new boltcli err "+err.Error(), 1)
+	}
+	defer cmd.Close()
+
+	if err := cmd.WithBucket([]byte(bucket)).Del([]byte(key)); err != nil {
+		return cli.Exit("Delete err "+err.Error(), 1)
+	}
+
+	fmt.Println("Deleted " + key)
+	return nil
+}
+
+func dbDelBucket(c *cli.Context) error {
+	path := boltcli.ParsePath(c.Args().First())
+	if len(path) == 0 {
+		return cli.Exit("DeleteBucket err, need bucket name.", 1)
+	}
+
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
+	if err != nil {
+		return cli.Exit("new boltcli err "+err.Error(), 1)
+	}
+	defer cmd.Close()
+
+	if !c.Bool("yes") {
+		ok, err := console.Confirm("Delete bucket " + boltcli.FormatPath(path) + "?")
+		if err != nil {
+			return cli.Exit("DeleteBucket err "+err.Error(), 1)
+		}
+		if !ok {
+			return cli.Exit("DeleteBucket cancelled", 1)
+		}
+	}
+
+	if err := cmd.DelBucket(path[0], path[1:]...); err != nil {
+		return cli.Exit("DeleteBucket err "+err.Error(), 1)
+	}
+
+	fmt.Println("Bucket deleted: " + boltcli.FormatPath(path))
+	return nil
+}
+
+func dbUndo(c *cli.Context) error {
+	if !boltcli.IsFileExist(dbfile) {
+		return cli.Exit("Db file is not exists: "+dbfile, 1)
+	}
+
+	cmd, err := boltcli.New(dbfile, dbOptions()...)
+	if err != nil {
+		return cli.Exit("new boltcli err "+err.Error(), 1)
+	}
+	defer cmd.Close()
+
+	if c.Bool("list") {
+		entries, err := cmd.UndoList()
+		if err != nil {
+			return cli.Exit("Undo list err "+err.Error(), 1)
+		}
+
+		for _, e := range entries {
+			fmt.Println(e)
+		}
+		return nil
+	}
+
+	e, err := cmd.Undo()
+	if err == boltcli.ErrNothingToUndo && undoKeep <= 0 {
+		return cli.Exit("Undo err "+err.Error()+", the undo is enabled by --undo-keep", 1)
+	} else if err != nil {
+		return cli.Exit("Undo err "+err.Error(), 1)
+	}
+
+	fmt.Println("Undone " + e.String())
+	return nil
+}
+
+func dbInfo(c *cli.Context) error {
+	if !boltcli.IsFileExist(dbfile) {
+		return cli.Exit("Db file is not exists: "+dbfile, 1)
+	}
+
+	cmd, err := boltcli.New(dbfile)
+	if err != nil {
+		return cli.Exit("new boltcli err "+err.Error(), 1)
+	}
+	defer cmd.Close()
+
+	info, err := cmd.Info(c.Int("top"))
+	if err != nil {
+		return cli.Exit("Info err "+err.Error(), 1)
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	return console.Page(func(w io.Writer) error {
+		info.Fprint(w)
+		return nil
+	})
+}
+
+func dbAnalyze(c *cli.Context) error {
+	if !boltcli.IsFileExist(dbfile) {
+		return cli.Exit("Db file is not exists: "+dbfile, 1)
+	}
+
+	cmd, err := boltcli.New(dbfile)
+	if err != nil {
+		return cli.Exit("new boltcli err "+err.Error(), 1)
+	}
+	defer cmd.Close()
+
+	a, err := cmd.Analyze(boltcli.ParsePath(bucket), boltcli.AnalyzeOption{
+		Top: c.Int("top"), Depth: c.Int("depth"), Separators: c.String("separators"),
+	})
+	if err != nil {
+		return cli.Exit("Analyze err "+err.Error(), 1)
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(a)
+	}
+
+	return console.Page(func(w io.Writer) error {
+		a.Fprint(w)
+		return nil
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/bingoohuang/boltcli/internal/console"
+	"github.com/urfave/cli/v2"
+)
+
+// The page commands read the db file directly without locking it,
+// so they also work while another process has the db opened.
+
+func openPageFile() (*boltcli.PageFile, error) {
+	if !boltcli.IsFileExist(dbfile) {
+		return nil, cli.Exit("Db file is not exists: "+dbfile, 1)
+	}
+
+	p, err := boltcli.OpenPageFile(dbfile)
+	if err != nil {
+		return nil, cli.Exit("open pages err "+err.Error(), 1)
+	}
+
+	return p, nil
+}
+
+func pagesList(c *cli.Context) error {
+	p, err := openPageFile()
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	if c.IsSet("bucket") {
+		return pagesTree(p, boltcli.ParsePath(c.String("bucket")))
+	}
+
+	pages, err := p.Pages()
+	if err != nil {
+		return cli.Exit("pages err "+err.Error(), 1)
+	}
+
+	return console.Page(func(w io.Writer) error {
+		fmt.Fprintf(w, "%-10s %-10s %8s %8s %6s\n", "ID", "TYPE", "ITEMS", "OVERFLOW", "UTIL")
+		for _, page := range pages {
+			fmt.Fprintf(w, "%-10d %-10s %8d %8d %5.0f%%\n", page.ID, page.Type, page.Count, page.Overflow, page.Utilization()*100)
+		}
+
+		fmt.Fprintf(w, "\nPage size %d, %d pages, tx %d.\n", p.PageSize, p.Meta.PageN, p.Meta.TxID)
+		fmt.Fprintln(w, "Utilization of the branch and leaf pages.")
+		h := boltcli.UtilizationHistogram(pages)
+		max := 1
+		for _, n := range h {
+			if n > max {
+				max = n
+			}
+		}
+		for i, n := range h {
+			fmt.Fprintf(w, "%3d-%3d%% | %-50s %d\n", i*10, i*10+10, strings.Repeat("#", n*50/max), n)
+		}
+
+		return nil
+	})
+}
+
+func pagesTree(p *boltcli.PageFile, path [][]byte) error {
+	return console.Page(func(w io.Writer) error {
+		fmt.Fprintf(w, "B+tree of %s\n", boltcli.FormatPath(path))
+		err := p.Tree(path, func(depth int, info boltcli.PageInfo, elems []boltcli.PageElem) bool {
+			id := strconv.FormatUint(info.ID, 10)
+			if depth == 0 && info.ID == 0 {
+				id = "inline"
+			}
+
+			fmt.Fprintf(w, "%spage %s %s items=%d overflow=%d util=%.0f%%",
+				strings.Repeat("    ", depth), id, info.Type, info.Count, info.Overflow, info.Utilization()*100)
+			if len(elems) > 0 {
+				fmt.Fprintf(w, " keys=%s..%s", displayBytes(elems[0].Key), displayBytes(elems[len(elems)-1].Key))
+			}
+			fmt.Fprintln(w)
+			return true
+		})
+		if err != nil {
+			return cli.Exit("pages err "+err.Error(), 1)
+		}
+
+		return nil
+	})
+}
+
+func pageShow(c *cli.Context) error {
+	id, err := strconv.ParseUint(c.Args().First(), 10, 64)
+	if err != nil {
+		return cli.Exit("need page id", 1)
+	}
+
+	p, err := openPageFile()
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	info, elems, err := p.Page(id)
+	if err != nil {
+		return cli.Exit("page err "+err.Error(), 1)
+	}
+
+	return console.Page(func(w io.Writer) error {
+		fmt.Fprintf(w, "Page ID:    %d\n", info.ID)
+		fmt.Fprintf(w, "Page Type:  %s\n", info.Type)
+		fmt.Fprintf(w, "Items:      %d\n", info.Count)
+		fmt.Fprintf(w, "Overflow:   %d\n", info.Overflow)
+		fmt.Fprintf(w, "Used:       %d of %d bytes (%.0f%%)\n", info.Used, info.Size, info.Utilization()*100)
+		fmt.Fprintln(w)
+
+		for i, e := range elems {
+			switch {
+			case info.Type == boltcli.PageBranch:
+				fmt.Fprintf(w, "%4d %s -> page %d\n", i, displayBytes(e.Key), e.Child)
+			case e.Bucket && len(e.Value) < 16:
+				fmt.Fprintf(w, "%4d %s = <bucket with a header of %d bytes, corrupt>\n", i, displayBytes(e.Key), len(e.Value))
+			case e.Bucket:
+				root, seq := binary.LittleEndian.Uint64(e.Value), binary.LittleEndian.Uint64(e.Value[8:])
+				kind := fmt.Sprintf("root page %d", root)
+				if root == 0 {
+					kind = "inline"
+				}
+				fmt.Fprintf(w, "%4d %s = <bucket %s, seq %d>\n", i, displayBytes(e.Key), kind, seq)
+			default:
+				fmt.Fprintf(w, "%4d %s = %s (%s, %d bytes)\n", i, displayBytes(e.Key), displayBytes(e.Value),
+					boltcli.DetectCodec(e.Value), len(e.Value))
+			}
+		}
+
+		return nil
+	})
+}
+
+func freelistShow(c *cli.Context) error {
+	p, err := openPageFile()
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	ids, err := p.Freelist()
+	if err != nil {
+		return cli.Exit("freelist err "+err.Error(), 1)
+	}
+
+	return console.Page(func(w io.Writer) error {
+		for _, id := range ids {
+			fmt.Fprintln(w, id)
+		}
+		fmt.Fprintf(w, "Total: %d free pages of %d.\n", len(ids), p.Meta.PageN)
+		return nil
+	})
+}
+
+// displayBytes shows text as quoted and binary as hex, truncated to a screen width.
+func displayBytes(b []byte) string {
+	const max = 60
+
+	s := strconv.Quote(string(b))
+	if boltcli.DetectCodec(b) == boltcli.CodecBinary {
+		s = "0x" + hex.EncodeToString(b)
+	}
+
+	if len(s) > max {
+		return s[:max] + "..."
+	}
+
+	return s
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/urfave/cli/v2"
+)
+
+// conns holds the opened boltdb files by name, boltCli is the current one.
+var (
+	conns   = map[string]*boltcli.DB{}
+	current string
+)
+
+func connNames() []string {
+	names := make([]string, 0, len(conns))
+	for name := range conns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func closeConn(name string) {
+	db := conns[name]
+	if db == nil {
+		return
+	}
+
+	if db.InTx() {
+		n, _ := db.Rollback()
+		fmt.Printf("WARNING: transaction on %s rolled back, %d pending changes discarded\n", name, n)
+	}
+
+	db.Close()
+	delete(conns, name)
+	if name == current {
+		boltCli, current = nil, ""
+	}
+}
+
+func closeAll() {
+	for _, name := range connNames() {
+		closeConn(name)
+	}
+}
+
+func dbOpen(c *cli.Context) error {
+	dbFile := c.Args().First()
+	if dbFile == "" {
+		return errors.New("need db file")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(dbFile), filepath.Ext(dbFile))
+	if c.Args().Get(1) == "as" && c.Args().Get(2) != "" {
+		name = c.Args().Get(2)
+	} else if c.Args().Len() > 1 {
+		return errors.New("usage: open FILE [as NAME]")
+	}
+
+	for other, db := range conns {
+		if other != name && sameFile(db.DbFile, dbFile) {
+			return fmt.Errorf("%s is already opened as %s", dbFile, other)
+		}
+	}
+
+	// the db file is locked while open, so the same file is switched to instead of opened again.
+	if db := conns[name]; db != nil && sameFile(db.DbFile, dbFile) {
+		boltCli, current = db, name
+		fmt.Println(dbFile + " is already opened as " + name)
+		return nil
+	}
+
+	fns := []boltcli.OptionFn{boltcli.WithUndo(undoKeep)}
+	if journal {
+		fns = append(fns, boltcli.WithJournal(boltcli.JournalDir(dbFile)))
+	}
+
+	db, err := boltcli.New(dbFile, fns...)
+	if err != nil {
+		return errors.New("new boltCli err " + err.Error())
+	}
+
+	// the connection of the name is replaced only once the new db is opened.
+	closeConn(name)
+	conns[name] = db
+	boltCli, current = db, name
+	fmt.Println(dbFile + " opened as " + name)
+	return nil
+}
+
+func dbClose(c *cli.Context) error {
+	name := current
+	if c.Args().Present() {
+		name = c.Args().First()
+	}
+
+	db := conns[name]
+	if db == nil {
+		fmt.Println("No dbfile is opened.")
+		return nil
+	}
+
+	fmt.Println(db.DbFile + " closed")
+	closeConn(name)
+	return nil
+}
+
+func dbSwitch(c *cli.Context) error {
+	name := c.Args().First()
+	db := conns[name]
+	if db == nil {
+		return fmt.Errorf("no db named %q, use dbs to list the opened ones", name)
+	}
+
+	boltCli, current = db, name
+	fmt.Println("Switch to " + name)
+	return nil
+}
+
+func dbDbs(c *cli.Context) error {
+	for _, name := range connNames() {
+		db, mark := conns[name], " "
+		if name == current {
+			mark = "*"
+		}
+
+		tx := ""
+		if db.InTx() {
+			tx = fmt.Sprintf("\t[tx: %d pending]", db.Pending())
+		}
+
+		fmt.Printf("%s %s\t%s\t%s%s\n", mark, name, db.DbFile, boltcli.FormatPath(db.Path), tx)
+	}
+
+	fmt.Printf("Total: %d dbs.\n", len(conns))
+	return nil
+}
+
+func sameFile(a, b string) bool {
+	a, _ = filepath.Abs(a)
+	b, _ = filepath.Abs(b)
+	return a == b
+}
+
+// resolveRef resolves a reference like prod:users/42 into an opened db and a path.
+// The path after a db name starts at its root, a reference without a known db name
+// is resolved against the current bucket of the current db.
+func resolveRef(ref string) (*boltcli.DB, [][]byte, error) {
+	db := boltCli
+	if i := strings.Index(ref, ":"); i >= 0 && conns[ref[:i]] != nil {
+		db, ref = conns[ref[:i]], boltcli.PathSeparator+ref[i+1:]
+	}
+
+	if db == nil {
+		return nil, nil, ErrDbNotOpen
+	}
+
+	return db, resolvePath(db, ref), nil
+}
+
+func dbCopy(c *cli.Context) error {
+	if c.Args().Len() != 2 {
+		return errors.New("usage: copy [DB:]SRC [DB:]DST")
+	}
+
+	src, srcPath, err := resolveRef(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	dst, dstPath, err := resolveRef(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	n, err := boltcli.Copy(dst, dstPath, src, srcPath)
+	if err != nil {
+		return errors.New("Copy err " + err.Error())
+	}
+
+	fmt.Printf("Copied %d keys.\n", n)
+	return nil
+}
+
+func dbUndo(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	if c.Bool("list") {
+		entries, err := boltCli.UndoList()
+		if err != nil {
+			return errors.New("Undo list err " + err.Error())
+		}
+
+		for _, e := range entries {
+			fmt.Println(e)
+		}
+		fmt.Printf("Total: %d undo entries.\n", len(entries))
+		return nil
+	}
+
+	e, err := boltCli.Undo()
+	if err == boltcli.ErrNothingToUndo && undoKeep <= 0 {
+		return errors.New("Undo err " + err.Error() + ", the undo is enabled by -undo-keep")
+	} else if err != nil {
+		return errors.New("Undo err " + err.Error())
+	}
+
+	fmt.Println("Undone " + e.String())
+	return nil
+}
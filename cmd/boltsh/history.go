@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+)
+
+const (
+	historyFileName = ".boltsh_history"
+	rcFileName      = ".boltshrc"
+	historyMaxLines = 1000
+)
+
+// history keeps the entered command lines and mirrors them into ~/.boltsh_history.
+type history struct {
+	file  string
+	lines []string
+}
+
+func homeFile(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, name)
+}
+
+func loadHistory(file string) *history {
+	h := &history{file: file}
+	if file == "" {
+		return h
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+
+	if len(h.lines) > historyMaxLines {
+		h.lines = h.lines[len(h.lines)-historyMaxLines:]
+		h.rewrite()
+	}
+
+	return h
+}
+
+// rewrite truncates the history file to the lines kept in memory.
+func (h *history) rewrite() {
+	content := strings.Join(h.lines, "\n") + "\n"
+	if err := os.WriteFile(h.file, []byte(content), 0600); err != nil {
+		fmt.Println("write history err " + err.Error())
+	}
+}
+
+func (h *history) Add(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || len(h.lines) > 0 && h.lines[len(h.lines)-1] == line {
+		return
+	}
+
+	h.lines = append(h.lines, line)
+	if h.file == "" {
+		return
+	}
+
+	f, err := os.OpenFile(h.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Println("open history err " + err.Error())
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		fmt.Println("write history err " + err.Error())
+	}
+}
+
+// reverseSearch implements Ctrl-R: the text typed so far is the search term,
+// pressing Ctrl-R again steps to the next older history line containing it.
+type reverseSearch struct {
+	h     *history
+	term  string
+	last  string
+	index int
+}
+
+func (h *history) reverseSearch() *reverseSearch {
+	return &reverseSearch{h: h, index: len(h.lines)}
+}
+
+func (r *reverseSearch) search(buf *prompt.Buffer) {
+	text := buf.Text()
+	if r.last == "" || text != r.last {
+		r.term, r.index = text, len(r.h.lines)
+	}
+
+	for i := r.index - 1; i >= 0; i-- {
+		line := r.h.lines[i]
+		if line == text || !strings.Contains(line, r.term) {
+			continue
+		}
+
+		r.index, r.last = i, line
+		buf.CursorRight(len([]rune(text)))
+		buf.DeleteBeforeCursor(len([]rune(text)))
+		buf.InsertText(line, false, true)
+		return
+	}
+}
+
+func (r *reverseSearch) KeyBind() prompt.KeyBind {
+	return prompt.KeyBind{Key: prompt.ControlR, Fn: r.search}
+}
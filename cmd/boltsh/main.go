@@ -2,12 +2,16 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/bingoohuang/boltcli"
+	"github.com/bingoohuang/boltcli/internal/console"
+	"github.com/bingoohuang/boltcli/internal/zstd"
+	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/c-bata/go-prompt"
@@ -21,53 +25,115 @@ var (
 
 func completer(d prompt.Document) []prompt.Suggest {
 	s := []prompt.Suggest{
-		{Text: "open", Description: "short:[o]; open a boltdb file. e.g: open test.db"},
-		{Text: "close", Description: "short:[c]; close boltdb file. e.g: close"},
+		{Text: "open", Description: "short:[o]; open a boltdb file with an optional name. e.g: open prod.bolt as prod"},
+		{Text: "close", Description: "short:[c]; close the current or the named boltdb file. e.g: close stg"},
+		{Text: "switch", Description: "switch to another opened boltdb file. e.g: switch stg"},
+		{Text: "dbs", Description: "list the opened boltdb files. e.g: dbs"},
+		{Text: "copy", Description: "copy a key or a bucket between opened dbs. e.g: copy prod:users/42 stg:users/42"},
 		{Text: "exit", Description: "short:[x]; exit this shell. e.g: eixt/quit"},
 		{Text: "use", Description: "short:[u]; select a bucket. e.g: use bucketname"},
 		{Text: "bucket.new", Description: "short:[nb]; create a bucket. e.g: newbucket bucketname"},
-		{Text: "bucket.del", Description: "short:[db]; delete a bucket. e.g: deletebucket bucketname"},
+		{Text: "bucket.del", Description: "short:[db]; delete a bucket. e.g: bucket.del --yes bucketname"},
+		{Text: "versions", Description: "keep the versions of the keys in the current bucket, off to stop. e.g: versions 10"},
+		{Text: "history", Description: "list the versions of a key in a versioned bucket. e.g: history keyname"},
+		{Text: "revert", Description: "write a version of a key back. e.g: revert keyname 3"},
+		{Text: "undo", Description: "undo the latest destructive command, --list to show the log. e.g: undo"},
 		{Text: "bucket.list", Description: "short:[lb]; list buckets in the dbfile. e.g: listbucket"},
 		{Text: "set", Description: "short:[s]; set value to key in current bucket. e.g: set keyname value"},
 		{Text: "delete", Description: "short:[d]; Delete a key in the `BUCKET`.. e.g: delete keyname"},
 		{Text: "get", Description: "short:[g]; get a value by key in current bucket. e.g: get keyname"},
-		{Text: "list", Description: "short:[ls]; list all keys and values in the bucket. e.g: list"},
+		{Text: "view", Description: "pretty print a value by its detected codec. e.g: view keyname"},
+		{Text: "edit", Description: "edit a value in $EDITOR. e.g: edit keyname"},
+		{Text: "list", Description: "short:[ls]; list all keys and values in the bucket, -l the sub buckets and keys with value sizes. e.g: ls -l"},
+		{Text: "cd", Description: "change the current bucket, nested buckets separated by /. e.g: cd a/b, cd .."},
+		{Text: "pwd", Description: "print the current bucket path. e.g: pwd"},
+		{Text: "tree", Description: "show nested buckets and keys as a tree. e.g: tree -L 2"},
 		{Text: "seq.next", Description: "short:[ns]; Get next sequence of current bucket.. e.g: nextsequence"},
 		{Text: "seq", Description: "short:[seq]; Get  sequence of current bucket. e.g: sequence"},
 		{Text: "seq.set", Description: "short:[ss]; Set sequence of current bucket. e.g: setsequence 123"},
-		{Text: "backup", Description: "short:[bak]; create a backup of the boltdb file. e.g: backup"},
+		{Text: "backup", Description: "short:[bak]; create a checked backup of the boltdb file next to it. e.g: backup --compress gzip"},
 		{Text: "show", Description: "short:[sh]; Show parameters of the db. e.g: show"},
 		{Text: "stats", Description: "short:[st]; Show stats of the db. e.g: stats"},
+		{Text: "info", Description: "Show file level stats with the largest buckets and keys. e.g: info --top 10"},
+		{Text: "begin", Description: "start a transaction kept across commands. e.g: begin"},
+		{Text: "commit", Description: "commit the current transaction. e.g: commit"},
+		{Text: "rollback", Description: "rollback the current transaction. e.g: rollback"},
+		{Text: "source", Description: "short:[.]; run commands from a file. e.g: source init.bsh"},
 		{Text: "help", Description: "short:[h]; Show help information. e.g: help"},
 	}
 	return prompt.FilterHasPrefix(s, d.GetWordBeforeCursor(), true)
 }
 
+var (
+	scriptCmds string
+	scriptFile string
+	undoKeep   int
+	journal    bool
+)
+
+func init() {
+	flag.StringVar(&scriptCmds, "c", "", "Run `COMMANDS` separated by ; and exit")
+	flag.StringVar(&scriptFile, "f", "", "Run commands from script `FILE` and exit")
+	flag.BoolVar(&stopOnError, "stop-on-error", false, "Stop a script at the first failing command")
+	flag.BoolVar(&echoCmds, "echo", false, "Echo script commands before running them")
+	flag.IntVar(&undoKeep, "undo-keep", 0, "Number of destructive commands kept for undo like 100, 0 disables undo")
+	flag.BoolVar(&journal, "journal", false, "Append the writes to the journal FILE.journal for incremental backups")
+}
+
 func main() {
+	flag.Parse()
+	zstd.Register()
+
+	// 非交互模式: -c, -f 或者从管道读取命令，不加载 ~/.boltshrc。
+	if scriptCmds != "" || scriptFile != "" || !console.IsTerminal(os.Stdin) {
+		os.Exit(runScript())
+	}
+
+	if rc := homeFile(rcFileName); rc != "" && boltcli.IsFileExist(rc) {
+		if err := source(rc); err != nil {
+			fmt.Println(err)
+		}
+	}
+
 	// 可传递文件名到程序。
-	if len(os.Args) > 1 {
-		handleCmd("open " + os.Args[1])
+	if flag.NArg() > 0 {
+		handleCmd("open " + flag.Arg(0))
 	}
 
+	h := loadHistory(homeFile(historyFileName))
 	for bRunning := true; bRunning; {
-		t := prompt.Input("> ", completer)
+		t := prompt.Input(promptPrefix(), completer,
+			prompt.OptionHistory(h.lines),
+			prompt.OptionAddKeyBind(h.reverseSearch().KeyBind()))
+		h.Add(t)
 		switch t {
 		case "quit", "exit":
-			closeDB()
+			closeAll()
 			bRunning = false
 		default:
-			handleCmd(t)
+			if err := runCmd(t); errors.Is(err, errExit) {
+				closeAll()
+				bRunning = false
+			} else if err != nil {
+				fmt.Println(err)
+			}
 		}
 	}
 
 	fmt.Println("bye!")
 }
 
-func closeDB() {
-	if boltCli != nil {
-		boltCli.Close()
-		boltCli = nil
+func promptPrefix() string {
+	if !isBoltCliReady() {
+		return "> "
+	}
+
+	prefix := current + ":" + boltcli.FormatPath(boltCli.Path) + "> "
+	if boltCli.InTx() {
+		return "[tx] " + prefix
 	}
+
+	return prefix
 }
 
 func isBoltCliReady() bool {
@@ -75,16 +141,19 @@ func isBoltCliReady() bool {
 }
 
 func handleCmd(cmd string) {
-	if len(strings.Trim(cmd, "")) == 0 {
-		return
+	if err := runCmd(cmd); err != nil {
+		fmt.Println(err)
 	}
-	args := strings.Split(cmd, " ")
-	args = append([]string{"boltsh"}, args...)
+}
 
-	err := cliApp.Run(args)
-	if err != nil {
-		fmt.Println(err)
+func runCmd(cmd string) error {
+	args := splitArgs(cmd)
+	if len(args) == 0 {
+		return nil
 	}
+	args = append([]string{"boltsh"}, args...)
+
+	return cliApp.Run(args)
 }
 
 func init() {
@@ -92,21 +161,37 @@ func init() {
 		Name: "boltsh", Usage: "a shell for boltdb file", Version: "0.0.1",
 		Compiled: time.Now(), EnableBashCompletion: true, HideHelp: false, HideVersion: false,
 		Action: func(c *cli.Context) error {
+			if c.Args().Present() {
+				return fmt.Errorf("unknown command %q, use help", c.Args().First())
+			}
 			fmt.Println("Use boltsh --help")
 			return nil
 		},
 	}
 
 	cliApp.Commands = []*cli.Command{
-		{Name: "open", Aliases: []string{"o"}, Category: "database", Usage: "Open a boltdb file",
+		{Name: "open", Aliases: []string{"o"}, Category: "database", Usage: "Open a boltdb file, e.g. open prod.bolt as prod",
 			Action: dbOpen, Flags: []cli.Flag{&cli.BoolFlag{Name: "forever", Aliases: []string{"forevvarr"}}}},
-		{Name: "close", Aliases: []string{"c"}, Category: "database", Usage: "Close a boltdb file", Action: dbClose},
-		{Name: "backup", Aliases: []string{"bak"}, Category: "database", Usage: "Close a backup of the moltdb file", Action: dbBackup},
+		{Name: "close", Aliases: []string{"c"}, Category: "database", Usage: "Close the current or the named boltdb file", Action: dbClose},
+		{Name: "switch", Category: "database", Usage: "Switch to another opened boltdb file", Action: dbSwitch},
+		{Name: "dbs", Category: "database", Usage: "List the opened boltdb files", Action: dbDbs},
+		{Name: "copy", Aliases: []string{"cp"}, Category: "data", Usage: "Copy a key or a bucket, e.g. copy prod:users/42 stg:users/42", Action: dbCopy},
+		{Name: "backup", Aliases: []string{"bak"}, Category: "database", Usage: "Create a checked backup of the boltdb file next to it", Action: dbBackup,
+			Flags: []cli.Flag{&cli.StringFlag{Name: "compress", Value: "none", Usage: "Compression gzip, zstd or none"}}},
 		{Name: "use", Aliases: []string{"u"}, Category: "database", Usage: "Switch current bucket", Action: dbUse},
 		{Name: "bucket.new", Category: "database", Aliases: []string{"bn"}, Usage: "Create a new bucket. boltCli -f test.db nb newbucket", Action: dbNewBucket},
-		{Name: "bucket.del", Aliases: []string{"bd"}, Category: "data", Usage: "Delete a bucket.", Action: dbDeleteBucket},
+		{Name: "bucket.del", Aliases: []string{"bd"}, Category: "data", Usage: "Delete a bucket after confirmation.", Action: dbDeleteBucket,
+			Flags: []cli.Flag{&cli.BoolFlag{Name: "yes", Aliases: []string{"y"}, Usage: "Delete without confirmation"}}},
+		{Name: "undo", Category: "data", Usage: "Undo the latest destructive command.", Action: dbUndo,
+			Flags: []cli.Flag{&cli.BoolFlag{Name: "list", Aliases: []string{"l"}, Usage: "List the undo log instead"}}},
+		{Name: "versions", Category: "data", Usage: "Keep up to LIMIT versions per key in the current bucket, 0 for all, off to stop.", Action: dbVersions},
+		{Name: "history", Category: "data", Usage: "List the versions of a key in a versioned bucket, the latest first.", Action: dbHistory},
+		{Name: "revert", Category: "data", Usage: "Write a version of a key back, e.g. revert keyname 3", Action: dbRevert},
 		{Name: "get", Aliases: []string{"g"}, Category: "data", Usage: "Get value from a key in the `BUCKET`", Action: dbGet, Flags: []cli.Flag{&cli.BoolFlag{Name: "forever", Aliases: []string{"forevvarr"}}}},
-		{Name: "list", Aliases: []string{"ls"}, Category: "data", Usage: "List all data in the `BUCKET`.", Action: dbList},
+		{Name: "view", Aliases: []string{"v"}, Category: "data", Usage: "Pretty print a value by its detected codec.", Action: dbView},
+		{Name: "edit", Aliases: []string{"e"}, Category: "data", Usage: "Edit a value in $EDITOR and write it back on save.", Action: dbEdit},
+		{Name: "list", Aliases: []string{"ls"}, Category: "data", Usage: "List all data in the `BUCKET`.", Action: dbList,
+			Flags: []cli.Flag{&cli.BoolFlag{Name: "l", Usage: "List the sub buckets and keys with value sizes instead"}}},
 		{Name: "set", Aliases: []string{"s"}, Category: "data", Usage: "Set value by a key in the `BUCKET`.", Action: dbSet},
 		{Name: "delete", Aliases: []string{"d"}, Category: "data", Usage: "Delete a key in the `BUCKET`.", Action: dbDelete},
 		{Name: "seq.next", Category: "data", Usage: "Get NextSequence of current bucket.", Action: dbNextSeq},
@@ -115,6 +200,16 @@ func init() {
 		{Name: "bucket.list", Aliases: []string{"bl"}, Category: "database", Usage: "List all buckets in the db.", Action: dbListBucket},
 		{Name: "show", Aliases: []string{"sh"}, Category: "database", Usage: "Show parameters of the db.", Action: dbShow},
 		{Name: "stats", Aliases: []string{"st"}, Category: "database", Usage: "short:[st]; Show stats of the db. e.g: stats", Action: dbStats},
+		{Name: "cd", Category: "navigation", Usage: "Change the current bucket, e.g. cd /a/b, cd .., cd /", Action: dbCd},
+		{Name: "pwd", Category: "navigation", Usage: "Print the current bucket path.", Action: dbPwd},
+		{Name: "tree", Category: "navigation", Usage: "Show nested buckets and keys as a tree.", Action: dbTree,
+			Flags: []cli.Flag{&cli.IntFlag{Name: "L", Usage: "Descend only `LEVEL` directories deep"}}},
+		{Name: "begin", Category: "transaction", Usage: "Begin a writable transaction kept across commands.", Action: txBegin},
+		{Name: "commit", Category: "transaction", Usage: "Commit the current transaction.", Action: txCommit},
+		{Name: "rollback", Category: "transaction", Usage: "Rollback the current transaction.", Action: txRollback},
+		{Name: "info", Category: "database", Usage: "Show file level stats of the db with the largest buckets and keys.", Action: dbInfo,
+			Flags: []cli.Flag{&cli.IntFlag{Name: "top", Value: 10, Usage: "Number of the largest buckets and keys to show"}}},
+		{Name: "source", Aliases: []string{"."}, Category: "shell", Usage: "Run commands from a script file.", Action: shSource},
 	}
 
 	sort.Sort(cli.FlagsByName(cliApp.Flags))
@@ -126,44 +221,23 @@ var (
 	ErrSetSeqNeedNum = errors.New("set sequence need a number")
 )
 
-func dbOpen(c *cli.Context) error {
-	dbFile := c.Args().First()
-
-	closeDB()
-
-	var err error
-	boltCli, err = boltcli.New(dbFile)
-	if err != nil {
-		return errors.New("new boltCli err " + err.Error())
+func dbBackup(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
 	}
-	fmt.Println(dbFile + " opened")
-	return nil
-}
 
-func dbClose(c *cli.Context) error {
-	if isBoltCliReady() {
-		fmt.Println(boltCli.DbFile + " closed")
-		closeDB()
-	} else {
-		fmt.Println("No dbfile is opened.")
+	compression := c.String("compress")
+	if compression == "none" {
+		compression = boltcli.CompressNone
 	}
-	return nil
-}
 
-func dbBackup(c *cli.Context) error {
-	if isBoltCliReady() {
-		date := time.Now().Format("20060102150405")
-		filePath := boltCli.DbFile + "-" + date + ".bak"
-
-		err := boltCli.Backup(filePath)
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			fmt.Println("Backup ok: " + filePath)
-		}
-	} else {
-		fmt.Println("No dbfile is opened.")
+	dir := filepath.Dir(boltCli.DbFile)
+	e, err := boltCli.BackupFile(dir, compression)
+	if err != nil {
+		return errors.New("Backup err " + err.Error())
 	}
+
+	fmt.Println("Backup ok: " + filepath.Join(dir, e.File) + ", sha256 " + e.SHA256)
 	return nil
 }
 
@@ -207,20 +281,25 @@ func dbList(c *cli.Context) error {
 		return ErrDbNotOpen
 	}
 
-	cnt := 0
-	err := boltCli.List(func(index int, key, v []byte) bool {
-		cnt = cnt + 1
-		fmt.Printf("get %d %s.%s=%s\n", cnt, boltCli.Bucket, key, string(v))
-		return true
-
-	})
-	if err != nil {
-		return errors.New("list bucket err " + err.Error())
+	if c.Bool("l") {
+		return dbLs(c)
 	}
 
-	fmt.Println(fmt.Sprintf("Total: %d items.", cnt))
+	return console.Page(func(w io.Writer) error {
+		cnt := 0
+		err := boltCli.List(func(index int, key, v []byte) bool {
+			cnt = cnt + 1
+			fmt.Fprintf(w, "get %d %s.%s=%s\n", cnt, boltCli.Bucket, key, string(v))
+			return true
 
-	return nil
+		})
+		if err != nil {
+			return errors.New("list bucket err " + err.Error())
+		}
+
+		fmt.Fprintf(w, "Total: %d items.\n", cnt)
+		return nil
+	})
 }
 
 func dbSet(c *cli.Context) error {
@@ -291,10 +370,12 @@ func dbSetSequence(c *cli.Context) error {
 	if len(seq) == 0 {
 		return ErrSetSeqNeedNum
 	}
-	u, _ := strconv.ParseUint(seq, 0, 64)
-
-	err := boltCli.SetSeq(u)
+	u, err := strconv.ParseUint(seq, 0, 64)
 	if err != nil {
+		return ErrSetSeqNeedNum
+	}
+
+	if err := boltCli.SetSeq(u); err != nil {
 		return errors.New("Set err " + err.Error())
 	}
 
@@ -328,11 +409,14 @@ func dbNewBucket(c *cli.Context) error {
 
 	bucket := c.Args().First()
 
-	if len(bucket) == 0 {
+	path := boltcli.ParsePath(bucket)
+	if len(path) == 0 {
 		return errors.New("NewBucket err, need bucket name.")
 	}
 
-	boltCli.NewBucket([]byte(bucket))
+	if err := boltCli.NewBucket(path[0], path[1:]...); err != nil {
+		return errors.New("NewBucket err " + err.Error())
+	}
 
 	fmt.Println("Bucket created: " + bucket)
 	return nil
@@ -345,11 +429,27 @@ func dbDeleteBucket(c *cli.Context) error {
 
 	bucket := c.Args().First()
 
-	if len(bucket) == 0 {
+	path := boltcli.ParsePath(bucket)
+	if len(path) == 0 {
 		return errors.New("DeleteBucket err, need bucket name.")
 	}
 
-	err := boltCli.DelBucket([]byte(bucket))
+	if !c.Bool("yes") {
+		question := "Delete bucket " + boltcli.FormatPath(path)
+		if stats, err := boltCli.Stats(path[0], path[1:]...); err == nil {
+			question += fmt.Sprintf(" with %d keys", stats.KeyN)
+		}
+
+		ok, err := console.Confirm(question + "?")
+		if err != nil {
+			return errors.New("DeleteBucket err " + err.Error())
+		}
+		if !ok {
+			return errors.New("DeleteBucket('" + bucket + "') cancelled")
+		}
+	}
+
+	err := boltCli.DelBucket(path[0], path[1:]...)
 	if err != nil {
 		return errors.New("DeleteBucket('" + bucket + "') returns err : " + err.Error())
 	}
@@ -359,8 +459,15 @@ func dbDeleteBucket(c *cli.Context) error {
 }
 
 func dbShow(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
 	fmt.Printf("Current DB\t: %s \n", boltCli.DbFile)
-	fmt.Printf("Current Bucket\t: %s\n", boltCli.Bucket)
+	fmt.Printf("Current Bucket\t: %s\n", boltcli.FormatPath(boltCli.Path))
+	if boltCli.InTx() {
+		fmt.Printf("Transaction\t: %d pending changes\n", boltCli.Pending())
+	}
 	return nil
 }
 
@@ -369,7 +476,11 @@ func dbStats(c *cli.Context) error {
 		return ErrDbNotOpen
 	}
 
-	stats, err := boltCli.Stats(boltCli.Bucket)
+	if len(boltCli.Path) == 0 {
+		return errors.New("Stats err, cd into a bucket first")
+	}
+
+	stats, err := boltCli.Stats(boltCli.Path[0], boltCli.Path[1:]...)
 	if err != nil {
 		return errors.New("Stats err " + err.Error())
 	}
@@ -400,3 +511,19 @@ func dbStats(c *cli.Context) error {
 
 	return nil
 }
+
+func dbInfo(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	info, err := boltCli.Info(c.Int("top"))
+	if err != nil {
+		return errors.New("Info err " + err.Error())
+	}
+
+	return console.Page(func(w io.Writer) error {
+		info.Fprint(w)
+		return nil
+	})
+}
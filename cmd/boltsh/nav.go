@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/bingoohuang/boltcli/internal/console"
+	"github.com/urfave/cli/v2"
+)
+
+// resolvePath resolves an absolute or a relative (to the current bucket of db) path
+// like /a/b, ../c or . into bucket names.
+func resolvePath(db *boltcli.DB, arg string) [][]byte {
+	var path [][]byte
+	if !strings.HasPrefix(arg, boltcli.PathSeparator) {
+		path = append(path, db.Path...)
+	}
+
+	for _, name := range strings.Split(arg, boltcli.PathSeparator) {
+		switch name {
+		case "", ".":
+		case "..":
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		default:
+			path = append(path, []byte(name))
+		}
+	}
+
+	return path
+}
+
+func dbCd(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	path := resolvePath(boltCli, c.Args().First())
+	if !boltCli.HasBucket(path) {
+		return errors.New("no such bucket: " + boltcli.FormatPath(path))
+	}
+
+	boltCli.WithPath(path...)
+	return nil
+}
+
+func dbPwd(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	fmt.Println(boltcli.FormatPath(boltCli.Path))
+	return nil
+}
+
+// dbLs lists the sub buckets and the keys with their value sizes for list -l.
+func dbLs(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	return console.Page(func(w io.Writer) error {
+		buckets, keys := 0, 0
+		err := boltCli.Ls(func(index int, k, v []byte) bool {
+			if v == nil {
+				buckets++
+				fmt.Fprintf(w, "%-10s %s/\n", "<bucket>", k)
+			} else {
+				keys++
+				fmt.Fprintf(w, "%-10d %s\n", len(v), k)
+			}
+			return true
+		})
+		if err != nil {
+			return errors.New("ls err " + err.Error())
+		}
+
+		fmt.Fprintf(w, "Total: %d buckets, %d keys.\n", buckets, keys)
+		return nil
+	})
+}
+
+func dbTree(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	return console.Page(func(w io.Writer) error {
+		fmt.Fprintln(w, boltcli.FormatPath(boltCli.Path))
+		err := boltCli.Tree(c.Int("L"), func(depth int, k, v []byte) bool {
+			indent := strings.Repeat("│   ", depth-1)
+			if v == nil {
+				fmt.Fprintf(w, "%s├── %s/\n", indent, k)
+			} else {
+				fmt.Fprintf(w, "%s├── %s (%d bytes)\n", indent, k, len(v))
+			}
+			return true
+		})
+		if err != nil {
+			return errors.New("tree err " + err.Error())
+		}
+
+		return nil
+	})
+}
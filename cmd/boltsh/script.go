@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// maxSourceDepth guards against scripts that source themselves.
+const maxSourceDepth = 8
+
+var (
+	stopOnError bool
+	echoCmds    bool
+
+	sourceDepth int
+	failedCmds  int
+)
+
+var (
+	// errExit is returned when a script runs exit/quit.
+	errExit = errors.New("exit")
+	// errStopped is returned when a failure stops the script under -stop-on-error.
+	errStopped = errors.New("stopped on error")
+)
+
+// runScript runs boltsh non-interactively and returns the process exit code.
+func runScript() int {
+	defer closeAll()
+
+	err := func() error {
+		if flag.NArg() > 0 {
+			if err := runScriptCmd("args", "open "+flag.Arg(0)); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case scriptCmds != "":
+			return runLines("-c", strings.NewReader(scriptCmds))
+		case scriptFile != "":
+			return source(scriptFile)
+		default:
+			return runLines("stdin", os.Stdin)
+		}
+	}()
+
+	if err != nil && !errors.Is(err, errExit) && !errors.Is(err, errStopped) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if failedCmds > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// source runs the commands in file.
+func source(file string) error {
+	if sourceDepth >= maxSourceDepth {
+		return fmt.Errorf("source %s: nested too deeply", file)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sourceDepth++
+	defer func() { sourceDepth-- }()
+
+	return runLines(file, f)
+}
+
+// runLines runs the commands read from r, one or more per line separated by ;.
+// Blank lines and # comments are skipped, failures are reported with their position.
+func runLines(name string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		for _, cmd := range splitCommands(scanner.Text()) {
+			if err := runScriptCmd(fmt.Sprintf("%s:%d", name, n), cmd); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+func runScriptCmd(pos, cmd string) error {
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" || strings.HasPrefix(cmd, "#") {
+		return nil
+	}
+
+	if echoCmds {
+		fmt.Println("> " + cmd)
+	}
+
+	if cmd == "exit" || cmd == "quit" {
+		return errExit
+	}
+
+	err := runCmd(cmd)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, errExit) || errors.Is(err, errStopped) {
+		return err
+	}
+
+	failedCmds++
+	fmt.Fprintf(os.Stderr, "%s: %v\n", pos, err)
+	if stopOnError {
+		return errStopped
+	}
+
+	return nil
+}
+
+// splitCommands splits a line into commands separated by ; outside of quotes.
+func splitCommands(line string) []string {
+	var cmds []string
+	var quote rune
+	start := 0
+
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';':
+			cmds = append(cmds, line[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(cmds, line[start:])
+}
+
+// splitArgs splits a command into arguments separated by white spaces,
+// single or double quoted arguments may contain spaces.
+func splitArgs(cmd string) []string {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range cmd {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args
+}
+
+func shSource(c *cli.Context) error {
+	file := c.Args().First()
+	if file == "" {
+		return errors.New("need script file")
+	}
+
+	return source(file)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCommands(t *testing.T) {
+	for _, c := range []struct {
+		line string
+		cmds []string
+	}{
+		{"", []string{""}},
+		{"use a", []string{"use a"}},
+		{"use a; put k v", []string{"use a", " put k v"}},
+		{"use a;", []string{"use a", ""}},
+		{"use a;; put k v", []string{"use a", "", " put k v"}},
+		{";", []string{"", ""}},
+		{`put k "a;b"; get k`, []string{`put k "a;b"`, " get k"}},
+		{`put k 'a;"b'; get k`, []string{`put k 'a;"b'`, " get k"}},
+		// an unterminated quote runs to the end of the line.
+		{`put k "a;b`, []string{`put k "a;b`}},
+		// a backslash is no escape, so the paths of windows keep theirs.
+		{`source C:\tmp\a.bsh; ls`, []string{`source C:\tmp\a.bsh`, " ls"}},
+	} {
+		assert.Equal(t, c.cmds, splitCommands(c.line), c.line)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, c := range []struct {
+		cmd  string
+		args []string
+	}{
+		{"", nil},
+		{"  \t ", nil},
+		{"put k v", []string{"put", "k", "v"}},
+		{" put\tk  v ", []string{"put", "k", "v"}},
+		{`put k "a b"`, []string{"put", "k", "a b"}},
+		{`put k 'a "b" c'`, []string{"put", "k", `a "b" c`}},
+		{`put k "it's"`, []string{"put", "k", "it's"}},
+		{`put k ""`, []string{"put", "k", ""}},
+		{`put k a"b c"d`, []string{"put", "k", "ab cd"}},
+		{`put k "a b`, []string{"put", "k", "a b"}},
+		{`put k a\ b`, []string{"put", "k", `a\`, "b"}},
+	} {
+		assert.Equal(t, c.args, splitArgs(c.cmd), c.cmd)
+	}
+}
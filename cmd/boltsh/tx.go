@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+func txBegin(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	if err := boltCli.Begin(); err != nil {
+		return errors.New("Begin err " + err.Error())
+	}
+
+	fmt.Println("Transaction started, commit or rollback to finish it.")
+	return nil
+}
+
+func txCommit(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	n, err := boltCli.Commit()
+	if err != nil {
+		return errors.New("Commit err " + err.Error())
+	}
+
+	fmt.Printf("Transaction committed, %d changes.\n", n)
+	return nil
+}
+
+func txRollback(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	n, err := boltCli.Rollback()
+	if err != nil {
+		return errors.New("Rollback err " + err.Error())
+	}
+
+	fmt.Printf("Transaction rolled back, %d changes discarded.\n", n)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/bingoohuang/boltcli/internal/console"
+	"github.com/urfave/cli/v2"
+)
+
+func dbView(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	key := c.Args().First()
+	if key == "" {
+		return errors.New("need key")
+	}
+
+	v, err := boltCli.Get([]byte(key))
+	if err != nil {
+		return errors.New("get key err " + err.Error())
+	}
+
+	return console.Page(func(w io.Writer) error {
+		fmt.Fprintf(w, "%s.%s (%s, %d bytes)\n", boltCli.Bucket, key, boltcli.DetectCodec(v), len(v))
+		fmt.Fprintln(w, boltcli.Pretty(v))
+		return nil
+	})
+}
+
+func dbEdit(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	key := c.Args().First()
+	if key == "" {
+		return errors.New("need key")
+	}
+
+	old, err := boltCli.Get([]byte(key))
+	if err != nil && !errors.Is(err, boltcli.ErrBucketNotFound) {
+		return errors.New("get key err " + err.Error())
+	}
+
+	v, err := console.Edit(old, editSuffix(old))
+	if err != nil {
+		return errors.New("edit err " + err.Error())
+	}
+
+	if bytes.Equal(v, old) {
+		fmt.Println("No changes.")
+		return nil
+	}
+
+	if err := boltCli.CompareAndPut([]byte(key), old, v); err != nil {
+		return errors.New("Set err " + err.Error())
+	}
+
+	fmt.Printf("set %s.%s (%d bytes)\n", boltCli.Bucket, key, len(v))
+	return nil
+}
+
+// editSuffix names the temp file of the editor after the codec of v for syntax highlighting.
+func editSuffix(v []byte) string {
+	if boltcli.DetectCodec(v) == boltcli.CodecJSON {
+		return ".json"
+	}
+
+	return ".txt"
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/bingoohuang/boltcli/internal/console"
+	"github.com/urfave/cli/v2"
+)
+
+// dbVersions shows the versioning of the current bucket, versions LIMIT enables it and versions off disables it.
+func dbVersions(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	path := boltcli.FormatPath(boltCli.Path)
+	switch arg := c.Args().First(); arg {
+	case "":
+		limit, err := boltCli.VersionLimit()
+		if errors.Is(err, boltcli.ErrNotVersioned) {
+			fmt.Printf("bucket %s is not versioned\n", path)
+			return nil
+		}
+		if err != nil {
+			return errors.New("versions err " + err.Error())
+		}
+
+		fmt.Printf("bucket %s is versioned, keeping %s per key\n", path, versionLimit(limit))
+		return nil
+	case "off":
+		if err := boltCli.DisableVersions(); err != nil {
+			return errors.New("versions off err " + err.Error())
+		}
+
+		fmt.Printf("bucket %s is not versioned any more, its versions are dropped\n", path)
+		return nil
+	default:
+		limit, err := strconv.Atoi(arg)
+		if err != nil || limit < 0 {
+			return errors.New("versions need a limit number, 0 for no limit, or off")
+		}
+
+		if err := boltCli.EnableVersions(limit); err != nil {
+			return errors.New("versions err " + err.Error())
+		}
+
+		fmt.Printf("bucket %s is versioned, keeping %s per key\n", path, versionLimit(limit))
+		return nil
+	}
+}
+
+func versionLimit(limit int) string {
+	if limit == 0 {
+		return "all the versions"
+	}
+
+	return fmt.Sprintf("%d versions", limit)
+}
+
+func dbHistory(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	key := c.Args().First()
+	if key == "" {
+		return errors.New("need key")
+	}
+
+	versions, err := boltCli.History([]byte(key))
+	if err != nil {
+		return errors.New("history err " + err.Error())
+	}
+
+	return console.Page(func(w io.Writer) error {
+		for _, v := range versions {
+			fmt.Fprintln(w, v)
+		}
+		_, err := fmt.Fprintf(w, "Total: %d versions of %s.\n", len(versions), key)
+		return err
+	})
+}
+
+func dbRevert(c *cli.Context) error {
+	if !isBoltCliReady() {
+		return ErrDbNotOpen
+	}
+
+	key, version := c.Args().Get(0), c.Args().Get(1)
+	if key == "" || version == "" {
+		return errors.New("need key and version")
+	}
+
+	n, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return errors.New("version need a number")
+	}
+
+	v, err := boltCli.Revert([]byte(key), n)
+	if err != nil {
+		return errors.New("revert err " + err.Error())
+	}
+
+	fmt.Println("Reverted to " + v.String())
+	return nil
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+// apiPrefix is the prefix of the versioned JSON API.
+const apiPrefix = "/api/v1"
+
+// The error codes of the API error bodies.
+const (
+	CodeBadRequest     = "bad_request"
+	CodeBucketNotFound = "bucket_not_found"
+	CodeKeyNotFound    = "key_not_found"
+	CodeConflict       = "conflict"
+	CodeTooLarge       = "too_large"
+	CodeReadOnly       = "read_only"
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeInternal       = "internal"
+)
+
+// APIError is the body of the API error responses.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BucketView is a bucket with its direct nested buckets and the number of its keys.
+type BucketView struct {
+	Path    string   `json:"path"`
+	Buckets []string `json:"buckets"`
+	KeyN    int      `json:"keyN"`
+	Seq     uint64   `json:"seq"`
+}
+
+// TreeNode is a bucket in the tree of the nested buckets. Truncated tells it has nested buckets
+// below the depth of the tree.
+type TreeNode struct {
+	Name      string      `json:"name"`
+	Path      string      `json:"path"`
+	KeyN      int         `json:"keyN"`
+	Buckets   []*TreeNode `json:"buckets"`
+	Truncated bool        `json:"truncated,omitempty"`
+
+	path [][]byte
+}
+
+// registerAPI adds the routes of the API, a nested bucket path is like /api/v1/buckets/a/b,
+// and its keys are below /api/v1/buckets/a/b/keys. A bucket named keys is escaped like %6Beys.
+func registerAPI(r *gin.Engine) {
+	r.GET("/api/openapi.json", OpenAPI)
+
+	api := r.Group(apiPrefix)
+	api.GET("/buckets", apiListBuckets)
+	api.GET("/tree", apiTree)
+	api.GET("/export", apiExport)
+	api.POST("/import", apiImport)
+	api.GET("/stats", apiStats)
+	api.GET("/stats/buckets", apiBucketStats)
+	api.GET("/audit", apiAudit)
+	api.GET("/buckets/*path", apiGet)
+	api.PUT("/buckets/*path", apiPut)
+	api.DELETE("/buckets/*path", apiDelete)
+}
+
+// OpenAPI serves the OpenAPI document of the API, web/openapi.json.
+func OpenAPI(c *gin.Context) {
+	c.FileFromFS("openapi.json", http.FS(sub))
+}
+
+// apiTarget is the resource of a request below /api/v1/buckets.
+type apiTarget struct {
+	path [][]byte
+	// keys tells the request is about the keys of the bucket, key about a single one when not nil.
+	keys bool
+	key  []byte
+}
+
+// parseTarget parses the escaped request path, so the escaped slashes stay in the names.
+func parseTarget(c *gin.Context) (*apiTarget, error) {
+	rest := strings.TrimPrefix(c.Request.URL.EscapedPath(), apiPrefix+"/buckets")
+	var segments []string
+	for _, s := range strings.Split(rest, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+
+	t := &apiTarget{}
+	// the bucket names are escaped as %6Beys, so a raw keys before the last segment makes it a key,
+	// even a key named keys.
+	switch n := len(segments); {
+	case n >= 2 && segments[n-2] == "keys":
+		key, err := url.PathUnescape(segments[n-1])
+		if err != nil {
+			return nil, err
+		}
+		t.keys, t.key, segments = true, []byte(key), segments[:n-2]
+	case n >= 1 && segments[n-1] == "keys":
+		t.keys, segments = true, segments[:n-1]
+	}
+
+	for _, s := range segments {
+		name, err := url.PathUnescape(s)
+		if err != nil {
+			return nil, err
+		}
+		t.path = append(t.path, []byte(name))
+	}
+
+	if len(t.path) == 0 {
+		return nil, errors.New("no bucket path")
+	}
+
+	return t, nil
+}
+
+// dbAt returns a copy of the db switched to path with the user of the request as the author of the versions,
+// so the concurrent requests do not share them.
+func dbAt(c *gin.Context, path [][]byte) *boltcli.DB {
+	d := *db
+	if user := currentUser(c); user != "" {
+		d.SetUser(user)
+	}
+
+	return d.WithPath(path...)
+}
+
+// apiError writes the error with the status of its kind.
+func apiError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, CodeInternal
+	switch {
+	case errors.Is(err, boltcli.ErrBucketNotFound), errors.Is(err, bolt.ErrBucketNotFound):
+		status, code = http.StatusNotFound, CodeBucketNotFound
+	case errors.Is(err, boltcli.ErrKeyNotFound):
+		status, code = http.StatusNotFound, CodeKeyNotFound
+	case errors.Is(err, bolt.ErrIncompatibleValue), errors.Is(err, bolt.ErrBucketExists):
+		status, code = http.StatusConflict, CodeConflict
+	case errors.Is(err, bolt.ErrDatabaseReadOnly), errors.Is(err, bolt.ErrTxNotWritable):
+		status, code = http.StatusForbidden, CodeReadOnly
+	case errors.Is(err, bolt.ErrKeyRequired), errors.Is(err, bolt.ErrKeyTooLarge),
+		errors.Is(err, bolt.ErrValueTooLarge), errors.Is(err, bolt.ErrBucketNameRequired):
+		status, code = http.StatusBadRequest, CodeBadRequest
+	}
+
+	c.AbortWithStatusJSON(status, gin.H{"error": APIError{Code: code, Message: err.Error()}})
+}
+
+func badRequest(c *gin.Context, msg string) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": APIError{Code: CodeBadRequest, Message: msg}})
+}
+
+// apiListBuckets lists the top level buckets readable by the user.
+func apiListBuckets(c *gin.Context) {
+	buckets, err := db.GetBuckets()
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	names := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		if canRead(c, [][]byte{b}) {
+			names = append(names, string(b))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"buckets": names})
+}
+
+// apiTree returns the tree of the nested buckets below the path query like a/b, the root by default,
+// down to depth levels, 0 for all. The buckets the user cannot read are left out, unless they lead to readable ones.
+func apiTree(c *gin.Context) {
+	depth := 0
+	if s := c.Query("depth"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			badRequest(c, "depth should be a number not less than 0")
+			return
+		}
+		depth = n
+	}
+
+	path := boltcli.ParsePath(c.Query("path"))
+	root := &TreeNode{Path: boltcli.FormatPath(path), Buckets: []*TreeNode{}, path: path}
+	if len(path) > 0 {
+		root.Name = string(path[len(path)-1])
+	}
+
+	// one more level is walked to count the keys of the deepest buckets and to tell they have nested ones.
+	walkDepth := depth
+	if depth > 0 {
+		walkDepth++
+	}
+
+	stack := []*TreeNode{root}
+	err := dbAt(c, path).Tree(walkDepth, func(d int, k, v []byte) bool {
+		parent := stack[d-1]
+		switch {
+		case v != nil:
+			parent.KeyN++
+		case depth > 0 && d > depth:
+			parent.Truncated = true
+		default:
+			p := append(append([][]byte{}, parent.path...), k)
+			node := &TreeNode{Name: string(k), Path: boltcli.FormatPath(p), Buckets: []*TreeNode{}, path: p}
+			parent.Buckets = append(parent.Buckets, node)
+			stack = append(stack[:d], node)
+		}
+		return true
+	})
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	if !readableTree(c, root) && len(path) > 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": APIError{Code: CodeForbidden,
+			Message: "no readable bucket below " + root.Path}})
+		return
+	}
+
+	c.JSON(http.StatusOK, root)
+}
+
+// readableTree removes the nodes not readable by the user with no readable nested ones,
+// and tells whether the node is kept. The keys of the kept unreadable nodes are not counted.
+func readableTree(c *gin.Context, n *TreeNode) bool {
+	kept := n.Buckets[:0]
+	for _, b := range n.Buckets {
+		if readableTree(c, b) {
+			kept = append(kept, b)
+		}
+	}
+	n.Buckets = kept
+
+	if canRead(c, n.path) {
+		return true
+	}
+
+	n.KeyN = 0
+	return len(n.Buckets) > 0
+}
+
+func apiGet(c *gin.Context) {
+	t, err := parseTarget(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	switch {
+	case t.key != nil:
+		apiGetKey(c, t)
+	case t.keys:
+		apiListKeys(c, t)
+	default:
+		apiGetBucket(c, t)
+	}
+}
+
+func apiGetBucket(c *gin.Context, t *apiTarget) {
+	d := dbAt(c, t.path)
+	view := BucketView{Path: boltcli.FormatPath(t.path), Buckets: []string{}}
+	err := d.Ls(func(_ int, k, v []byte) bool {
+		if v == nil {
+			view.Buckets = append(view.Buckets, string(k))
+		} else {
+			view.KeyN++
+		}
+		return true
+	})
+	if err == nil {
+		view.Seq, err = d.Seq()
+	}
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// apiListKeys lists the keys of the bucket with the optional prefix, up to limit keys, 1000 by default.
+func apiListKeys(c *gin.Context, t *apiTarget) {
+	limit := 1000
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			badRequest(c, "limit should be a positive number")
+			return
+		}
+		limit = n
+	}
+
+	keys := []KeyView{}
+	err := dbAt(c, t.path).LsPrefix([]byte(c.Query("prefix")), func(_ int, k, v []byte) bool {
+		if v != nil {
+			keys = append(keys, newKeyView(k, v, listValueSize))
+		}
+		return len(keys) < limit
+	})
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"path": boltcli.FormatPath(t.path), "keys": keys})
+}
+
+// apiGetKey returns the key with its whole value, or the value as a file with the download query.
+func apiGetKey(c *gin.Context, t *apiTarget) {
+	v, err := dbAt(c, t.path).Lookup(t.key)
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	if _, ok := c.GetQuery("download"); ok {
+		download(c, t.key, v)
+		return
+	}
+
+	c.JSON(http.StatusOK, newKeyView(t.key, v, 0))
+}
+
+// apiPut creates the bucket with its parents, 201 if it is new, or puts the value of the request
+// as the value of the key, see readValue.
+func apiPut(c *gin.Context) {
+	t, err := parseTarget(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	if t.keys && t.key == nil {
+		badRequest(c, "no key")
+		return
+	}
+
+	if t.key == nil {
+		status := http.StatusCreated
+		if db.HasBucket(t.path) {
+			status = http.StatusOK
+		}
+
+		if err := db.NewBucket(t.path[0], t.path[1:]...); err != nil {
+			apiError(c, err)
+			return
+		}
+
+		c.JSON(status, BucketView{Path: boltcli.FormatPath(t.path), Buckets: []string{}})
+		return
+	}
+
+	value, err := readValue(c)
+	if errors.Is(err, errTooLarge) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": APIError{Code: CodeTooLarge, Message: err.Error()}})
+		return
+	}
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	auditValue(c, value)
+	if err := dbAt(c, t.path).Put(t.key, value); err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newKeyView(t.key, value, listValueSize))
+}
+
+// apiDelete deletes the bucket or the key.
+func apiDelete(c *gin.Context) {
+	t, err := parseTarget(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	switch {
+	case t.keys && t.key == nil:
+		badRequest(c, "no key")
+		return
+	case t.key == nil:
+		err = db.DelBucket(t.path[0], t.path[1:]...)
+	default:
+		d := dbAt(c, t.path)
+		if _, err = d.Lookup(t.key); err == nil {
+			err = d.Del(t.key)
+		}
+	}
+
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
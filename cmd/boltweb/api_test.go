@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+
+	var err error
+	db, err = boltcli.New(filepath.Join(t.TempDir(), "test.bolt"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return newRouter()
+}
+
+func serve(r http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	var body struct{ Error APIError }
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body.Error.Code
+}
+
+func TestAPIKeys(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := serve(r, "GET", "/api/v1/buckets/cfg/keys/name", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, CodeBucketNotFound, errorCode(t, w))
+
+	w = serve(r, "PUT", "/api/v1/buckets/cfg/sub/keys/name", "bingoo")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// an escaped slash stays in the key.
+	w = serve(r, "PUT", "/api/v1/buckets/cfg/sub/keys/"+url.PathEscape("a/b"), "c")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(r, "GET", "/api/v1/buckets/cfg/sub/keys/name", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"key":"name","value":"bingoo","base64":"YmluZ29v","contentType":"text/plain; charset=utf-8","size":6}`, w.Body.String())
+
+	w = serve(r, "GET", "/api/v1/buckets/cfg/sub/keys/missing", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, CodeKeyNotFound, errorCode(t, w))
+
+	w = serve(r, "GET", "/api/v1/buckets/cfg/sub/keys?prefix=a", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"path":"/cfg/sub","keys":[{"key":"a/b","value":"c","base64":"Yw==","contentType":"text/plain; charset=utf-8","size":1}]}`, w.Body.String())
+
+	w = serve(r, "GET", "/api/v1/buckets/cfg/sub/keys?limit=x", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, CodeBadRequest, errorCode(t, w))
+
+	w = serve(r, "PUT", "/api/v1/buckets/cfg/sub/keys", "v")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(r, "DELETE", "/api/v1/buckets/cfg/sub/keys/name", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serve(r, "DELETE", "/api/v1/buckets/cfg/sub/keys/name", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, CodeKeyNotFound, errorCode(t, w))
+}
+
+func TestAPIBuckets(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := serve(r, "PUT", "/api/v1/buckets/a/b", "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = serve(r, "PUT", "/api/v1/buckets/a/b", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a bucket named keys is escaped.
+	w = serve(r, "PUT", "/api/v1/buckets/a/%6Beys/keys/k", "v")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(r, "GET", "/api/v1/buckets", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"buckets":["a"]}`, w.Body.String())
+
+	w = serve(r, "GET", "/api/v1/buckets/a", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"path":"/a","buckets":["b","keys"],"keyN":0,"seq":0}`, w.Body.String())
+
+	w = serve(r, "DELETE", "/api/v1/buckets/a/b", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serve(r, "DELETE", "/api/v1/buckets/a/b", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, CodeBucketNotFound, errorCode(t, w))
+
+	w = serve(r, "GET", "/api/v1/buckets/missing", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(r, "PUT", "/api/v1/buckets/keys/k", "v")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, CodeBadRequest, errorCode(t, w))
+	// a key named keys, the last keys is the key.
+	w = serve(r, "PUT", "/api/v1/buckets/c/keys/keys", "v")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serve(r, "GET", "/api/v1/buckets/c/keys/keys", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"key":"keys"`)
+	w = serve(r, "GET", "/api/v1/buckets/c/keys", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"key":"keys"`)
+}
+
+func TestAPIBinaryValues(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := serve(r, "PUT", "/api/v1/buckets/b/keys/%FF%00", "\x89PNG\r\n\x1a\n\xff")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(r, "GET", "/api/v1/buckets/b/keys/%FF%00", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"key":"\ufffd\u0000","keyBase64":"/wA=","base64":"iVBORw0KGgr/","contentType":"image/png","size":9}`, w.Body.String())
+
+	w = serve(r, "GET", "/api/v1/buckets/b/keys/%FF%00?download", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename*=utf-8''_%00", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "\x89PNG\r\n\x1a\n\xff", w.Body.String())
+
+	// the JSON values are validated.
+	req := httptest.NewRequest("PUT", "/api/v1/buckets/b/keys/j", strings.NewReader(`{"a":`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("PUT", "/api/v1/buckets/b/keys/j", strings.NewReader(` {"a": [1]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"contentType":"application/json"`)
+
+	// the multipart uploads.
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	assert.Nil(t, mw.WriteField("note", "ignored"))
+	fw, err := mw.CreateFormFile("file", "a.bin")
+	assert.Nil(t, err)
+	fw.Write([]byte{0, 1, 2})
+	assert.Nil(t, mw.Close())
+	req = httptest.NewRequest("PUT", "/api/v1/buckets/b/keys/up", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	v, err := db.WithPath([]byte("b")).Get([]byte("up"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, v)
+
+	// the limits.
+	defer func(size int64) { maxValueSize = size }(maxValueSize)
+	maxValueSize = 8
+	w = serve(r, "PUT", "/api/v1/buckets/b/keys/big", "123456789")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, CodeTooLarge, errorCode(t, w))
+
+	long := "a" + strings.Repeat("é", listValueSize)
+	maxValueSize = 1 << 20
+	w = serve(r, "PUT", "/api/v1/buckets/b/keys/long", long)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(r, "GET", "/api/v1/buckets/b/keys?prefix=long", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list struct{ Keys []KeyView }
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.True(t, list.Keys[0].Truncated)
+	assert.Equal(t, len(long), list.Keys[0].Size)
+	// the cut value keeps its whole runes.
+	assert.Equal(t, long[:listValueSize-1], *list.Keys[0].Value)
+}
+
+func TestAPITree(t *testing.T) {
+	r := newTestRouter(t)
+	for _, target := range []string{"a/b/c/keys/k1", "a/b/keys/k2", "a/b/keys/k3", "a/keys/k4", "d/keys/k5"} {
+		assert.Equal(t, http.StatusOK, serve(r, "PUT", "/api/v1/buckets/"+target, "v").Code)
+	}
+
+	w := serve(r, "GET", "/api/v1/tree", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name":"","path":"/","keyN":0,"buckets":[
+		{"name":"a","path":"/a","keyN":1,"buckets":[
+			{"name":"b","path":"/a/b","keyN":2,"buckets":[
+				{"name":"c","path":"/a/b/c","keyN":1,"buckets":[]}]}]},
+		{"name":"d","path":"/d","keyN":1,"buckets":[]}]}`, w.Body.String())
+
+	w = serve(r, "GET", "/api/v1/tree?path=a&depth=1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name":"a","path":"/a","keyN":1,"buckets":[
+		{"name":"b","path":"/a/b","keyN":2,"buckets":[],"truncated":true}]}`, w.Body.String())
+
+	w = serve(r, "GET", "/api/v1/tree?path=missing", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve(r, "GET", "/api/v1/tree?depth=-1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLegacyHandlersStopOnError(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := serve(r, "POST", "/createBucket", "")
+	assert.Equal(t, "no bucket name | n", w.Body.String())
+
+	req := httptest.NewRequest("POST", "/put", strings.NewReader("bucket=b&value=v"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "no bucket name or key | n", w.Body.String())
+
+	buckets, err := db.GetBuckets()
+	assert.Nil(t, err)
+	assert.Empty(t, buckets)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/gin-gonic/gin"
+)
+
+// The operations of the audit log.
+const (
+	AuditPut          = "put"
+	AuditDeleteKey    = "deleteKey"
+	AuditDeleteBucket = "deleteBucket"
+	AuditCreateBucket = "createBucket"
+	AuditImport       = "import"
+	AuditRevert       = "revert"
+	AuditVersions     = "versions"
+)
+
+// audit enables the audit log of the writes in auditFile, DB.audit.jsonl by default, see -audit and -audit-file.
+var (
+	audit     = true
+	auditFile string
+)
+
+// auditLog is the audit log of the server, nil when it is disabled.
+var auditLog *AuditLog
+
+// auditKey keeps the audit entry of the request in the gin context.
+const auditKey = "boltweb.audit"
+
+// AuditEntry is a write request in the audit log. Size and SHA256 are of the value put, or of the imported file.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user,omitempty"`
+	Remote string    `json:"remote"`
+	Op     string    `json:"op"`
+	Bucket string    `json:"bucket"`
+	Key    string    `json:"key,omitempty"`
+	Size   int64     `json:"size,omitempty"`
+	SHA256 string    `json:"sha256,omitempty"`
+	// Status is the HTTP status of the reply, the failed and forbidden writes are logged too.
+	Status int `json:"status"`
+
+	// hash hashes the value read by auditReader.
+	hash hash.Hash
+}
+
+// AuditLog appends the entries to a JSON lines file, which is never rewritten.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog opens the audit log file for appending, creating it when it does not exist.
+func OpenAuditLog(name string) (*AuditLog, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditLog{file: f}, nil
+}
+
+// Close closes the file.
+func (l *AuditLog) Close() error { return l.file.Close() }
+
+// Append appends the entry as a line.
+func (l *AuditLog) Append(e *AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// AuditQuery selects the audit entries, the zero values select all.
+type AuditQuery struct {
+	From, To time.Time
+	User     string
+	// Bucket selects the entries of the bucket and of its nested buckets like /a/b.
+	Bucket string
+	Op     string
+	// Limit is the number of the latest entries returned, all with 0.
+	Limit int
+}
+
+func (q *AuditQuery) match(e *AuditEntry) bool {
+	return (q.From.IsZero() || !e.Time.Before(q.From)) && (q.To.IsZero() || e.Time.Before(q.To)) &&
+		(q.User == "" || e.User == q.User) && (q.Op == "" || e.Op == q.Op) &&
+		(q.Bucket == "" || q.Bucket == "/" || e.Bucket == q.Bucket || strings.HasPrefix(e.Bucket, q.Bucket+"/"))
+}
+
+// Query returns the latest entries selected by the query, the newest first.
+func (l *AuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the reads do not move the offset of the appends.
+	s := bufio.NewScanner(io.NewSectionReader(l.file, 0, 1<<62))
+	s.Buffer(nil, 1<<20)
+
+	// ring keeps the last limit entries selected.
+	limit := q.Limit
+	if limit <= 0 {
+		limit = int(^uint(0) >> 1)
+	}
+	var ring []AuditEntry
+	n := 0
+	for s.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil || !q.match(&e) {
+			continue
+		}
+
+		if len(ring) < limit {
+			ring = append(ring, e)
+		} else {
+			ring[n%limit] = e
+		}
+		n++
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(ring))
+	for i := n - 1; i >= 0 && i >= n-len(ring); i-- {
+		entries = append(entries, ring[i%limit])
+	}
+
+	return entries, nil
+}
+
+// auditWrites logs the write requests after they are served, with their user once authenticated.
+func auditWrites(c *gin.Context) {
+	if auditLog == nil {
+		c.Next()
+		return
+	}
+
+	e := &AuditEntry{Time: time.Now(), Remote: remoteHost(c.Request)}
+	c.Set(auditKey, e)
+	c.Next()
+
+	if !auditOp(c, e) {
+		return
+	}
+
+	e.User, e.Status = currentUser(c), c.Writer.Status()
+	if e.hash != nil {
+		e.SHA256 = hex.EncodeToString(e.hash.Sum(nil))
+	}
+	if err := auditLog.Append(e); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// auditOp sets the operation of the request with its bucket and key, false when it is not a write.
+func auditOp(c *gin.Context, e *AuditEntry) bool {
+	form := func(op string) bool {
+		e.Op, e.Bucket, e.Key = op, boltcli.FormatPath([][]byte{[]byte(c.PostForm("bucket"))}), c.PostForm("key")
+		return true
+	}
+
+	switch c.Request.Method + " " + c.FullPath() {
+	case "POST /put":
+		auditValue(c, []byte(c.PostForm("value")))
+		return form(AuditPut)
+	case "POST /deleteKey":
+		return form(AuditDeleteKey)
+	case "POST /deleteBucket":
+		return form(AuditDeleteBucket)
+	case "POST /createBucket":
+		return form(AuditCreateBucket)
+	case "POST /revert":
+		return form(AuditRevert)
+	case "POST /versions":
+		return form(AuditVersions)
+	case "POST /api/v1/import":
+		if dryRun, _ := strconv.ParseBool(c.Query("dryRun")); dryRun {
+			return false
+		}
+		e.Op, e.Bucket = AuditImport, boltcli.FormatPath(boltcli.ParsePath(c.Query("bucket")))
+		return true
+	case "PUT /api/v1/buckets/*path", "DELETE /api/v1/buckets/*path":
+		t, err := parseTarget(c)
+		if err != nil {
+			return false
+		}
+
+		e.Bucket, e.Key = boltcli.FormatPath(t.path), string(t.key)
+		switch {
+		case c.Request.Method == http.MethodPut && t.key != nil:
+			e.Op = AuditPut
+		case c.Request.Method == http.MethodPut:
+			e.Op = AuditCreateBucket
+		case t.key != nil:
+			e.Op = AuditDeleteKey
+		case !t.keys:
+			e.Op = AuditDeleteBucket
+		default:
+			return false
+		}
+		return true
+	}
+
+	return false
+}
+
+// auditValue records the size and hash of the value written by the request.
+func auditValue(c *gin.Context, v []byte) {
+	if e, ok := c.Value(auditKey).(*AuditEntry); ok {
+		sum := sha256.Sum256(v)
+		e.Size, e.SHA256 = int64(len(v)), hex.EncodeToString(sum[:])
+	}
+}
+
+// auditReader records the size and hash of what is read from r by the request.
+func auditReader(c *gin.Context, r io.Reader) io.Reader {
+	e, ok := c.Value(auditKey).(*AuditEntry)
+	if !ok {
+		return r
+	}
+
+	e.hash = sha256.New()
+	return io.TeeReader(r, writeFunc(func(p []byte) (int, error) {
+		e.Size += int64(len(p))
+		return e.hash.Write(p)
+	}))
+}
+
+type writeFunc func(p []byte) (int, error)
+
+func (f writeFunc) Write(p []byte) (int, error) { return f(p) }
+
+// AuditView is the entries of an audit log query, the newest first.
+type AuditView struct {
+	Enabled bool         `json:"enabled"`
+	Entries []AuditEntry `json:"entries"`
+}
+
+// apiAudit queries the audit log by the time range from and to in RFC 3339, user, bucket and op,
+// with the latest limit entries, 100 by default.
+func apiAudit(c *gin.Context) {
+	q := AuditQuery{User: c.Query("user"), Op: c.Query("op")}
+	if b := c.Query("bucket"); b != "" {
+		q.Bucket = boltcli.FormatPath(boltcli.ParsePath(b))
+	}
+
+	var err error
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if v := c.Query(name); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				badRequest(c, "invalid "+name+" time "+v+", use RFC 3339 like 2006-01-02T15:04:05Z")
+				return
+			}
+		}
+	}
+
+	if q.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "100")); err != nil || q.Limit < 1 {
+		badRequest(c, "invalid limit "+c.Query("limit"))
+		return
+	}
+
+	view := AuditView{Enabled: auditLog != nil, Entries: []AuditEntry{}}
+	if auditLog != nil {
+		if view.Entries, err = auditLog.Query(q); err != nil {
+			apiError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, view)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestAudit(t *testing.T) {
+	var err error
+	auditLog, err = OpenAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		auditLog.Close()
+		auditLog = nil
+	})
+}
+
+// queryAudit lists the ops like "put /a/b k by bob Forbidden" of the audit entries selected by the query.
+func queryAudit(t *testing.T, r http.Handler, query string, set func(req *http.Request)) []string {
+	w := serveAs(r, "GET", "/api/v1/audit?"+query, "", set)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var view AuditView
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &view))
+	assert.True(t, view.Enabled)
+
+	ops := []string{}
+	for _, e := range view.Entries {
+		op := e.Op + " " + e.Bucket
+		if e.Key != "" {
+			op += " " + e.Key
+		}
+		if e.User != "" {
+			op += " by " + e.User
+		}
+		if e.Status >= http.StatusBadRequest {
+			op += " " + http.StatusText(e.Status)
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+func TestAudit(t *testing.T) {
+	r := newTestRouter(t)
+	w := serve(r, "GET", "/api/v1/audit", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled":false,"entries":[]}`, w.Body.String())
+
+	openTestAudit(t)
+	start := time.Now()
+	assert.Equal(t, http.StatusCreated, serve(r, "PUT", "/api/v1/buckets/a/b", "").Code)
+	// the remote is the peer, not the forwarded address any client can send.
+	w = serveAs(r, "PUT", "/api/v1/buckets/a/b/keys/k", "value", func(req *http.Request) {
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, serve(r, "GET", "/api/v1/buckets/a/b/keys/k", "").Code)
+	body := `{"key":"i","value":"v"}`
+	assert.Equal(t, http.StatusOK, serve(r, "POST", "/api/v1/import?bucket=c&dryRun=true", body).Code)
+	assert.Equal(t, http.StatusOK, serve(r, "POST", "/api/v1/import?bucket=c", body).Code)
+	w = serveAs(r, "POST", "/deleteKey", "bucket=c&key=i", func(req *http.Request) {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusNotFound, serve(r, "DELETE", "/api/v1/buckets/a/b/keys/missing", "").Code)
+	assert.Equal(t, http.StatusNoContent, serve(r, "DELETE", "/api/v1/buckets/a", "").Code)
+
+	assert.Equal(t, []string{"deleteBucket /a", "deleteKey /a/b missing Not Found", "deleteKey /c i", "import /c",
+		"put /a/b k", "createBucket /a/b"}, queryAudit(t, r, "", nil))
+	assert.Equal(t, []string{"deleteKey /a/b missing Not Found", "put /a/b k", "createBucket /a/b"},
+		queryAudit(t, r, "bucket=a/b", nil))
+	assert.Equal(t, []string{"deleteKey /a/b missing Not Found", "deleteKey /c i"}, queryAudit(t, r, "op=deleteKey", nil))
+	assert.Equal(t, []string{"deleteBucket /a", "deleteKey /a/b missing Not Found"}, queryAudit(t, r, "limit=2", nil))
+	assert.Equal(t, []string{}, queryAudit(t, r, "from="+time.Now().Add(time.Hour).Format(time.RFC3339), nil))
+	assert.Equal(t, 6, len(queryAudit(t, r, "from="+start.Add(-time.Second).Format(time.RFC3339)+
+		"&to="+time.Now().Add(time.Second).Format(time.RFC3339), nil)))
+
+	entries, err := auditLog.Query(AuditQuery{Op: AuditPut, Limit: 10})
+	assert.Nil(t, err)
+	sum := sha256.Sum256([]byte("value"))
+	assert.Equal(t, int64(5), entries[0].Size)
+	assert.Equal(t, hex.EncodeToString(sum[:]), entries[0].SHA256)
+	assert.Equal(t, "192.0.2.1", entries[0].Remote)
+	entries, err = auditLog.Query(AuditQuery{})
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(entries))
+	assert.Equal(t, AuditDeleteBucket, entries[0].Op)
+	entries, err = auditLog.Query(AuditQuery{Op: AuditImport, Limit: 10})
+	assert.Nil(t, err)
+	sum = sha256.Sum256([]byte(body))
+	assert.Equal(t, int64(len(body)), entries[0].Size)
+	assert.Equal(t, hex.EncodeToString(sum[:]), entries[0].SHA256)
+
+	w = serve(r, "GET", "/api/v1/audit?from=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(r, "GET", "/api/v1/audit?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAuditUsers(t *testing.T) {
+	r := newAuthRouter(t)
+	openTestAudit(t)
+	alice, bob := basic("alice", "alice-pass"), basic("bob", "bob-pass")
+
+	assert.Equal(t, http.StatusOK, serveAs(r, "PUT", "/api/v1/buckets/cfg/keys/k", "v", bob).Code)
+	assert.Equal(t, http.StatusForbidden, serveAs(r, "DELETE", "/api/v1/buckets/cfg", "", bob).Code)
+	assert.Equal(t, http.StatusUnauthorized, serveAs(r, "DELETE", "/api/v1/buckets/cfg", "", nil).Code)
+	assert.Equal(t, http.StatusNoContent, serveAs(r, "DELETE", "/api/v1/buckets/cfg", "", alice).Code)
+
+	// the audit log is for the admins only.
+	assert.Equal(t, http.StatusForbidden, serveAs(r, "GET", "/api/v1/audit", "", bob).Code)
+	assert.Equal(t, []string{"deleteBucket /cfg by alice", "deleteBucket /cfg Unauthorized",
+		"deleteBucket /cfg by bob Forbidden", "put /cfg k by bob"}, queryAudit(t, r, "", alice))
+	assert.Equal(t, []string{"deleteBucket /cfg by bob Forbidden", "put /cfg k by bob"}, queryAudit(t, r, "user=bob", alice))
+}
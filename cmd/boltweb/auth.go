@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrBadCredentials = errors.New("bad credentials")
+
+// Authenticator finds the user of a request.
+type Authenticator interface {
+	// Authenticate returns the user, "" when the request has no credentials of its kind,
+	// and ErrBadCredentials when it has wrong ones.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// Htpasswd authenticates the basic auth by an htpasswd file with bcrypt or {SHA} passwords.
+type Htpasswd struct {
+	hashes map[string]string
+
+	mu sync.Mutex
+	// verified keeps the checksums of the verified credentials, bcrypt is slow on purpose.
+	verified map[[sha256.Size]byte]bool
+}
+
+// LoadHtpasswd loads the USER:HASH lines of an htpasswd file, as made by htpasswd -B.
+func LoadHtpasswd(file string) (*Htpasswd, error) {
+	h := &Htpasswd{hashes: map[string]string{}, verified: map[[sha256.Size]byte]bool{}}
+	err := readLines(file, func(line string) error {
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return errors.New("not a USER:HASH line")
+		}
+
+		user, hash := line[:i], line[i+1:]
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return fmt.Errorf("unsupported hash of user %s, use bcrypt (htpasswd -B) or {SHA}", user)
+		}
+
+		h.hashes[user] = hash
+		return nil
+	})
+
+	return h, err
+}
+
+func (h *Htpasswd) Authenticate(r *http.Request) (string, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", nil
+	}
+
+	hash, found := h.hashes[user]
+	if !found {
+		return "", ErrBadCredentials
+	}
+
+	sum := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + hash))
+	h.mu.Lock()
+	verified := h.verified[sum]
+	h.mu.Unlock()
+	if verified {
+		return user, nil
+	}
+
+	if strings.HasPrefix(hash, "{SHA}") {
+		s := sha1.Sum([]byte(password))
+		if subtle.ConstantTimeCompare([]byte(hash[5:]), []byte(base64.StdEncoding.EncodeToString(s[:]))) != 1 {
+			return "", ErrBadCredentials
+		}
+	} else if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return "", ErrBadCredentials
+	}
+
+	h.mu.Lock()
+	h.verified[sum] = true
+	h.mu.Unlock()
+	return user, nil
+}
+
+// Tokens authenticates the static bearer tokens.
+type Tokens struct {
+	users map[string]string
+}
+
+// LoadTokens loads the TOKEN USER lines of a tokens file.
+func LoadTokens(file string) (*Tokens, error) {
+	t := &Tokens{users: map[string]string{}}
+	err := readLines(file, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return errors.New("not a TOKEN USER line")
+		}
+
+		t.users[fields[0]] = fields[1]
+		return nil
+	})
+
+	return t, err
+}
+
+func (t *Tokens) Authenticate(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", nil
+	}
+
+	token := strings.TrimSpace(auth[len("Bearer "):])
+	for known, user := range t.users {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			return user, nil
+		}
+	}
+
+	return "", ErrBadCredentials
+}
+
+// ProxyHeader trusts the user in a header set by a reverse proxy doing the authentication,
+// only for the requests coming from the proxy addresses.
+type ProxyHeader struct {
+	Header  string
+	Trusted []*net.IPNet
+}
+
+// NewProxyHeader trusts the header from the comma separated CIDRs or IPs.
+func NewProxyHeader(header, trusted string) (*ProxyHeader, error) {
+	p := &ProxyHeader{Header: header}
+	for _, s := range strings.Split(trusted, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		p.Trusted = append(p.Trusted, ipNet)
+	}
+
+	return p, nil
+}
+
+func (p *ProxyHeader) Authenticate(r *http.Request) (string, error) {
+	user := r.Header.Get(p.Header)
+	if user == "" {
+		return "", nil
+	}
+
+	if ip := net.ParseIP(remoteHost(r)); ip != nil {
+		for _, n := range p.Trusted {
+			if n.Contains(ip) {
+				return user, nil
+			}
+		}
+	}
+
+	return "", ErrBadCredentials
+}
+
+// Role is the access level of a user to a bucket.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleReadOnly
+	RoleWriter
+	RoleAdmin
+)
+
+var roleNames = map[string]Role{"read-only": RoleReadOnly, "writer": RoleWriter, "admin": RoleAdmin}
+
+func (r Role) String() string {
+	for name, role := range roleNames {
+		if role == r {
+			return name
+		}
+	}
+
+	return "none"
+}
+
+// Grant gives a role on the buckets whose path like a/b starts with Prefix.
+type Grant struct {
+	User   string
+	Role   Role
+	Prefix string
+}
+
+// ACL holds the grants of the users, the user * applies to all.
+type ACL struct {
+	grants []Grant
+}
+
+// LoadACL loads the USER ROLE [BUCKET_PREFIX] lines of an acl file, the roles are read-only, writer and admin.
+func LoadACL(file string) (*ACL, error) {
+	a := &ACL{}
+	err := readLines(file, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return errors.New("not a USER ROLE [BUCKET_PREFIX] line")
+		}
+
+		role, ok := roleNames[fields[1]]
+		if !ok {
+			return fmt.Errorf("unknown role %s", fields[1])
+		}
+
+		g := Grant{User: fields[0], Role: role}
+		if len(fields) == 3 {
+			g.Prefix = strings.Trim(fields[2], boltcli.PathSeparator)
+		}
+
+		a.grants = append(a.grants, g)
+		return nil
+	})
+
+	return a, err
+}
+
+// Role returns the role of the user on the bucket path, the one of the grant with the longest prefix
+// matching it, the grants of the user before the ones of *. A nil ACL makes every user an admin.
+func (a *ACL) Role(user string, path [][]byte) Role {
+	if a == nil {
+		return RoleAdmin
+	}
+
+	name := strings.TrimPrefix(boltcli.FormatPath(path), boltcli.PathSeparator)
+	best, bestLen, bestUser := RoleNone, -1, false
+	for _, g := range a.grants {
+		if g.User != user && g.User != "*" || !strings.HasPrefix(name, g.Prefix) {
+			continue
+		}
+
+		isUser := g.User == user
+		if len(g.Prefix) > bestLen || len(g.Prefix) == bestLen && isUser && !bestUser {
+			best, bestLen, bestUser = g.Role, len(g.Prefix), isUser
+		}
+	}
+
+	return best
+}
+
+func readLines(file string, f func(line string) error) error {
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := f(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", file, n, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// userKey keeps the authenticated user in the gin context.
+const userKey = "boltweb.user"
+
+// currentUser is the user of the request, "" when the authentication is disabled.
+func currentUser(c *gin.Context) string { return c.GetString(userKey) }
+
+// Auth authenticates the requests by the authenticators in turn and checks the role
+// needed by the route on its bucket, see routeAccess.
+type Auth struct {
+	Authenticators []Authenticator
+	// ACL is nil to make every authenticated user an admin.
+	ACL *ACL
+	// Basic asks the browsers for the basic auth credentials.
+	Basic bool
+}
+
+func (a *Auth) Middleware(c *gin.Context) {
+	user, err := a.authenticate(c.Request)
+	if err != nil || user == "" {
+		if a.Basic {
+			c.Header("WWW-Authenticate", `Basic realm="boltweb"`)
+		}
+		if err == nil {
+			err = errors.New("authentication required")
+		}
+
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": APIError{Code: CodeUnauthorized, Message: err.Error()}})
+		return
+	}
+
+	c.Set(userKey, user)
+	role, path, err := routeAccess(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	if role != RoleNone && a.ACL.Role(user, path) < role {
+		msg := fmt.Sprintf("user %s needs the %s role on bucket %s", user, role, boltcli.FormatPath(path))
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": APIError{Code: CodeForbidden, Message: msg}})
+		return
+	}
+
+	c.Next()
+}
+
+func (a *Auth) authenticate(r *http.Request) (string, error) {
+	for _, au := range a.Authenticators {
+		if user, err := au.Authenticate(r); err != nil || user != "" {
+			return user, err
+		}
+	}
+
+	return "", nil
+}
+
+// auth is the authentication of the server, nil when it is disabled.
+var auth *Auth
+
+// canRead tells whether the user of the request can read the bucket, to filter the bucket lists.
+func canRead(c *gin.Context, path [][]byte) bool {
+	return auth == nil || auth.ACL.Role(currentUser(c), path) >= RoleReadOnly
+}
+
+// routeAccess returns the role needed by the request on the bucket path, RoleNone when any
+// authenticated user is allowed. The unknown routes need the admin role on the root.
+func routeAccess(c *gin.Context) (Role, [][]byte, error) {
+	form := func(role Role) (Role, [][]byte, error) {
+		return role, [][]byte{[]byte(c.PostForm("bucket"))}, nil
+	}
+
+	switch c.Request.Method + " " + c.FullPath() {
+	case "GET /", "GET /ping", "GET /web/*filepath", "HEAD /web/*filepath", "GET /api/openapi.json",
+		"GET /buckets", "GET /api/v1/buckets", "GET /api/v1/tree":
+		// the bucket lists and trees are filtered by canRead.
+		return RoleNone, nil, nil
+	case "GET /info", "GET /api/v1/stats", "GET /metrics":
+		return RoleReadOnly, nil, nil
+	case "GET /api/v1/stats/buckets":
+		// the buckets are filtered by canRead.
+		return RoleNone, nil, nil
+	case "GET /analyze":
+		return RoleReadOnly, boltcli.ParsePath(c.Query("bucket")), nil
+	case "GET /history":
+		return RoleReadOnly, [][]byte{[]byte(c.Query("bucket"))}, nil
+	case "POST /get", "POST /prefixScan":
+		return form(RoleReadOnly)
+	case "POST /put", "POST /deleteKey", "POST /revert", "POST /createBucket":
+		return form(RoleWriter)
+	case "POST /deleteBucket", "POST /versions":
+		return form(RoleAdmin)
+	case "GET /api/v1/audit":
+		return RoleAdmin, nil, nil
+	case "GET /api/v1/export":
+		return RoleReadOnly, boltcli.ParsePath(c.Query("bucket")), nil
+	case "POST /api/v1/import":
+		// the replace mode deletes the keys not imported.
+		if c.Query("mode") == ImportReplace {
+			return RoleAdmin, boltcli.ParsePath(c.Query("bucket")), nil
+		}
+		return RoleWriter, boltcli.ParsePath(c.Query("bucket")), nil
+	case "GET /api/v1/buckets/*path", "PUT /api/v1/buckets/*path", "DELETE /api/v1/buckets/*path":
+		t, err := parseTarget(c)
+		if err != nil {
+			return RoleNone, nil, err
+		}
+
+		switch {
+		case c.Request.Method == http.MethodGet:
+			return RoleReadOnly, t.path, nil
+		case c.Request.Method == http.MethodDelete && !t.keys:
+			return RoleAdmin, t.path, nil
+		default:
+			return RoleWriter, t.path, nil
+		}
+	}
+
+	return RoleAdmin, nil, nil
+}
+
+// remoteHost is the host of the peer of r, the forwarded headers any client can send are not trusted.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func newAuthRouter(t *testing.T) *gin.Engine {
+	hash, err := bcrypt.GenerateFromPassword([]byte("alice-pass"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	// {SHA} of bob-pass.
+	h, err := LoadHtpasswd(writeFile(t, "htpasswd", "alice:"+string(hash)+"\nbob:{SHA}eeQU2GomNu5hx6odcdNLXz4ZPOg=\n"))
+	assert.Nil(t, err)
+
+	tokens, err := LoadTokens(writeFile(t, "tokens", "# TOKEN USER\ns3cr3t carol\n"))
+	assert.Nil(t, err)
+
+	proxy, err := NewProxyHeader("X-Forwarded-User", "192.0.2.0/24")
+	assert.Nil(t, err)
+
+	acl, err := LoadACL(writeFile(t, "acl", `
+alice admin
+bob writer cfg
+bob read-only
+carol read-only pub
+* read-only pub/open
+dave admin /
+`))
+	assert.Nil(t, err)
+
+	auth = &Auth{Authenticators: []Authenticator{h, tokens, proxy}, ACL: acl, Basic: true}
+	t.Cleanup(func() { auth = nil })
+
+	r := newTestRouter(t)
+	for _, b := range []string{"cfg", "other", "pub"} {
+		assert.Nil(t, db.NewBucket([]byte(b)))
+	}
+
+	return r
+}
+
+func serveAs(r http.Handler, method, target, body string, set func(req *http.Request)) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if set != nil {
+		set(req)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func basic(user, password string) func(req *http.Request) {
+	return func(req *http.Request) { req.SetBasicAuth(user, password) }
+}
+
+func TestAuthenticate(t *testing.T) {
+	r := newAuthRouter(t)
+
+	w := serveAs(r, "GET", "/api/v1/buckets", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="boltweb"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, CodeUnauthorized, errorCode(t, w))
+
+	w = serveAs(r, "GET", "/api/v1/buckets", "", basic("alice", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	for i := 0; i < 2; i++ { // the second one is verified by the cache.
+		w = serveAs(r, "GET", "/api/v1/buckets", "", basic("alice", "alice-pass"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w = serveAs(r, "GET", "/api/v1/buckets", "", basic("bob", "bob-pass"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serveAs(r, "GET", "/api/v1/buckets", "", func(req *http.Request) { req.Header.Set("Authorization", "Bearer bad") })
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// the proxy header is trusted only from the proxy addresses, httptest requests come from 192.0.2.1.
+	w = serveAs(r, "GET", "/api/v1/buckets", "", func(req *http.Request) { req.Header.Set("X-Forwarded-User", "dave") })
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/buckets", "", func(req *http.Request) {
+		req.Header.Set("X-Forwarded-User", "dave")
+		req.RemoteAddr = "198.51.100.1:1234"
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuthorize(t *testing.T) {
+	r := newAuthRouter(t)
+	bob := basic("bob", "bob-pass")
+	carol := func(req *http.Request) { req.Header.Set("Authorization", "Bearer s3cr3t") }
+
+	w := serveAs(r, "PUT", "/api/v1/buckets/cfg/keys/k", "v", bob)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/buckets/other/keys/k", "v", bob)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, CodeForbidden, errorCode(t, w))
+	w = serveAs(r, "GET", "/api/v1/buckets/other/keys", "", bob)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "DELETE", "/api/v1/buckets/cfg", "", bob)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// the imports replacing the keys need the admin role.
+	w = serveAs(r, "POST", "/api/v1/import?bucket=cfg", `{"key":"i","value":"v"}`, bob)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "POST", "/api/v1/import?bucket=cfg&mode=replace", `{"key":"i","value":"v"}`, bob)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "GET", "/api/v1/export?bucket=other", "", bob)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the legacy form routes are checked on their bucket too.
+	w = serveAs(r, "POST", "/deleteKey", "bucket=other&key=k", func(req *http.Request) {
+		bob(req)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// the bucket lists are filtered.
+	w = serveAs(r, "GET", "/api/v1/buckets", "", carol)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list struct{ Buckets []string }
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, []string{"pub"}, list.Buckets)
+
+	// the tree keeps the unreadable buckets leading to readable ones, without their keys.
+	assert.Nil(t, db.NewBucket([]byte("pub"), []byte("open")))
+	assert.Equal(t, http.StatusOK, serveAs(r, "PUT", "/api/v1/buckets/cfg/keys/k", "v", basic("alice", "alice-pass")).Code)
+	w = serveAs(r, "GET", "/api/v1/tree", "", basic("eve", ""))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = serveAs(r, "GET", "/api/v1/tree", "", func(req *http.Request) { req.Header.Set("X-Forwarded-User", "eve") })
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name":"","path":"/","keyN":0,"buckets":[
+		{"name":"pub","path":"/pub","keyN":0,"buckets":[{"name":"open","path":"/pub/open","keyN":0,"buckets":[]}]}]}`, w.Body.String())
+	w = serveAs(r, "GET", "/api/v1/tree?path=cfg", "", func(req *http.Request) { req.Header.Set("X-Forwarded-User", "eve") })
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serveAs(r, "GET", "/info", "", carol)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "GET", "/info", "", bob)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/stats", "", carol)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "GET", "/api/v1/stats", "", bob)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/metrics", "", carol)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "GET", "/metrics", "", bob)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/stats/buckets?depth=0", "", carol)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var bucketStats BucketStatsView
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &bucketStats))
+	assert.Equal(t, []string{"/pub", "/pub/open"}, []string{bucketStats.Buckets[0].Path, bucketStats.Buckets[1].Path})
+	assert.Equal(t, 2, len(bucketStats.Buckets))
+
+	// the unknown routes need the admin role.
+	w = serveAs(r, "GET", "/nope", "", bob)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "GET", "/nope", "", basic("alice", "alice-pass"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serveAs(r, "DELETE", "/api/v1/buckets/cfg", "", basic("alice", "alice-pass"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestACLRole(t *testing.T) {
+	acl, err := LoadACL(writeFile(t, "acl", "bob writer cfg\nbob read-only\n* admin cfg/x\n* read-only\n"))
+	assert.Nil(t, err)
+
+	path := func(s ...string) [][]byte {
+		var p [][]byte
+		for _, name := range s {
+			p = append(p, []byte(name))
+		}
+		return p
+	}
+
+	assert.Equal(t, RoleWriter, acl.Role("bob", path("cfg", "a")))
+	assert.Equal(t, RoleWriter, acl.Role("bob", path("cfg2")))
+	assert.Equal(t, RoleReadOnly, acl.Role("bob", path("other")))
+	assert.Equal(t, RoleAdmin, acl.Role("bob", path("cfg", "x")))
+	assert.Equal(t, RoleReadOnly, acl.Role("eve", nil))
+	assert.Equal(t, RoleAdmin, (*ACL)(nil).Role("eve", nil))
+
+	_, err = LoadACL(writeFile(t, "acl", "bob root\n"))
+	assert.NotNil(t, err)
+	_, err = LoadHtpasswd(writeFile(t, "htpasswd", "bob:$apr1$x$y\n"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bingoohuang/boltcli/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t))
+	defer srv.Close()
+
+	ctx := context.Background()
+	cli := client.New(srv.URL + "/")
+
+	assert.Nil(t, cli.CreateBucket(ctx, "a", "keys"))
+	assert.Nil(t, cli.Put(ctx, []string{"a", "keys"}, "x/y", []byte("v")))
+	assert.Nil(t, cli.Put(ctx, []string{"a", "keys"}, "z", []byte("w")))
+
+	buckets, err := cli.Buckets(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, buckets)
+
+	b, err := cli.Bucket(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"keys"}, b.Buckets)
+
+	tree, err := cli.Tree(ctx, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "/a/keys", tree.Buckets[0].Buckets[0].Path)
+	assert.Equal(t, 2, tree.Buckets[0].Buckets[0].KeyN)
+
+	v, err := cli.Get(ctx, []string{"a", "keys"}, "x/y")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(v))
+
+	kvs, err := cli.Keys(ctx, []string{"a", "keys"}, "z", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []client.KeyValue{{Key: "z", Value: []byte("w"), ContentType: "text/plain; charset=utf-8", Size: 1}}, kvs)
+
+	// the values are binary safe.
+	assert.Nil(t, cli.Put(ctx, []string{"bin"}, "\xff", []byte{0, 0xff}))
+	v, err = cli.Get(ctx, []string{"bin"}, "\xff")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 0xff}, v)
+	kvs, err = cli.Keys(ctx, []string{"bin"}, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "\xff", kvs[0].Key)
+
+	assert.Nil(t, cli.Delete(ctx, []string{"a", "keys"}, "x/y"))
+	_, err = cli.Get(ctx, []string{"a", "keys"}, "x/y")
+	assert.True(t, client.IsNotFound(err))
+	assert.Equal(t, "key_not_found", err.(*client.Error).Code)
+
+	var export bytes.Buffer
+	assert.Nil(t, cli.Export(ctx, &export, "csv", "a"))
+	assert.Equal(t, "bucket,key,value,encoding\nkeys,z,w,\n", export.String())
+	result, err := cli.Import(ctx, &export, "csv", "merge", false, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Added)
+	v, err = cli.Get(ctx, []string{"b", "keys"}, "z")
+	assert.Nil(t, err)
+	assert.Equal(t, "w", string(v))
+
+	assert.Nil(t, cli.DeleteBucket(ctx, "a"))
+	_, err = cli.Bucket(ctx, "a")
+	assert.True(t, client.IsNotFound(err))
+}
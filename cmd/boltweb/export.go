@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/gin-gonic/gin"
+)
+
+// The formats of the exports and imports.
+const (
+	FormatNDJSON = "ndjson"
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+)
+
+// The modes of the imports, merge keeps the keys not imported, replace deletes them.
+const (
+	ImportMerge   = "merge"
+	ImportReplace = "replace"
+)
+
+// maxImportSize is the largest import body, see -max-import.
+var maxImportSize int64 = 100 << 20
+
+// importChangeN is the number of changes listed by an import result.
+const importChangeN = 100
+
+var formatTypes = map[string]string{
+	FormatNDJSON: "application/x-ndjson",
+	FormatJSON:   "application/json",
+	FormatCSV:    "text/csv; charset=utf-8",
+}
+
+// csvHeader is the first row of the CSV exports, the CSV imports find the columns by it.
+var csvHeader = []string{"bucket", "key", "value", "encoding"}
+
+// ExportRecord is a key of an export. Bucket is the path like a/b of its nested bucket below the exported one,
+// with the / and % in the names escaped as %2F and %25. Encoding is base64 when the key and the value are
+// base64 encoded, for the ones not valid UTF-8.
+type ExportRecord struct {
+	Bucket   string `json:"bucket,omitempty"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+func newExportRecord(path [][]byte, k, v []byte) ExportRecord {
+	names := make([]string, len(path))
+	for i, name := range path {
+		names[i] = boltcli.EscapeName(name)
+	}
+
+	r := ExportRecord{Bucket: strings.Join(names, "/"), Key: string(k), Value: string(v)}
+	if !utf8.Valid(k) || !utf8.Valid(v) {
+		r.Key, r.Value = base64.StdEncoding.EncodeToString(k), base64.StdEncoding.EncodeToString(v)
+		r.Encoding = "base64"
+	}
+
+	return r
+}
+
+// decode returns the bucket path, the key and the value of the record.
+func (r ExportRecord) decode() (path [][]byte, k, v []byte, err error) {
+	for _, s := range strings.Split(r.Bucket, "/") {
+		if s == "" {
+			continue
+		}
+		name, err := url.PathUnescape(s)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		path = append(path, []byte(name))
+	}
+
+	switch r.Encoding {
+	case "":
+		k, v = []byte(r.Key), []byte(r.Value)
+	case "base64":
+		if k, err = base64.StdEncoding.DecodeString(r.Key); err == nil {
+			v, err = base64.StdEncoding.DecodeString(r.Value)
+		}
+	default:
+		err = fmt.Errorf("unknown encoding %s", r.Encoding)
+	}
+
+	return path, k, v, err
+}
+
+// exportWriter writes the records of an export in its format.
+type exportWriter struct {
+	format string
+	w      *bufio.Writer
+	csv    *csv.Writer
+	n      int
+}
+
+func newExportWriter(w io.Writer, format string) *exportWriter {
+	e := &exportWriter{format: format, w: bufio.NewWriter(w)}
+	switch format {
+	case FormatJSON:
+		e.w.WriteString("[")
+	case FormatCSV:
+		e.csv = csv.NewWriter(e.w)
+		e.csv.Write(csvHeader)
+	}
+
+	return e
+}
+
+func (e *exportWriter) write(r ExportRecord) error {
+	e.n++
+	if e.csv != nil {
+		return e.csv.Write([]string{r.Bucket, r.Key, r.Value, r.Encoding})
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case e.format == FormatNDJSON:
+	case e.n > 1:
+		e.w.WriteString(",\n")
+	default:
+		e.w.WriteString("\n")
+	}
+	e.w.Write(data)
+	if e.format == FormatNDJSON {
+		return e.w.WriteByte('\n')
+	}
+
+	return nil
+}
+
+func (e *exportWriter) close() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if e.format == FormatJSON {
+		e.w.WriteString("\n]\n")
+	}
+
+	return e.w.Flush()
+}
+
+// apiExport streams the keys of the bucket query like a/b and of its nested buckets, all the buckets by default,
+// as a file in the format query, ndjson by default.
+func apiExport(c *gin.Context) {
+	format := c.DefaultQuery("format", FormatNDJSON)
+	contentType, ok := formatTypes[format]
+	if !ok {
+		badRequest(c, "format should be ndjson, json or csv")
+		return
+	}
+
+	bucket := boltcli.ParsePath(c.Query("bucket"))
+	if !db.HasBucket(bucket) {
+		apiError(c, boltcli.ErrBucketNotFound)
+		return
+	}
+
+	name := "boltweb"
+	if len(bucket) > 0 {
+		name = string(bytes.ToValidUTF8(bucket[len(bucket)-1], []byte("_")))
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	c.Status(http.StatusOK)
+
+	// the names of the nested buckets below the exported one, by depth.
+	var names [][]byte
+	var err error
+	w := newExportWriter(c.Writer, format)
+	treeErr := dbAt(c, bucket).Tree(0, func(depth int, k, v []byte) bool {
+		if v == nil {
+			names = append(names[:depth-1], k)
+			return true
+		}
+
+		err = w.write(newExportRecord(names[:depth-1], k, v))
+		return err == nil
+	})
+	if err == nil {
+		err = treeErr
+	}
+	if err == nil {
+		err = w.close()
+	}
+	if err != nil {
+		// the status is sent already, the client sees a truncated file.
+		c.Error(err)
+	}
+}
+
+// ImportResult tells what an import changes, or would change with the dry run.
+type ImportResult struct {
+	Bucket    string `json:"bucket"`
+	Format    string `json:"format"`
+	Mode      string `json:"mode"`
+	DryRun    bool   `json:"dryRun"`
+	Records   int    `json:"records"`
+	Added     int    `json:"added"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+	Deleted   int    `json:"deleted"`
+	// Changes lists the first changes.
+	Changes []ImportChange `json:"changes"`
+}
+
+// ImportChange is a key added, updated or deleted by an import.
+type ImportChange struct {
+	Op     string `json:"op"`
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key"`
+}
+
+func (r *ImportResult) change(op string, path [][]byte, k []byte) {
+	if len(r.Changes) < importChangeN {
+		r.Changes = append(r.Changes, newImportChange(op, path, k))
+	}
+}
+
+func newImportChange(op string, path [][]byte, k []byte) ImportChange {
+	rec := newExportRecord(path, k, nil)
+	return ImportChange{Op: op, Bucket: rec.Bucket, Key: string(bytes.ToValidUTF8(k, []byte("�")))}
+}
+
+// importItem is a decoded record of an import, its path is below the imported bucket.
+type importItem struct {
+	path  [][]byte
+	key   []byte
+	value []byte
+}
+
+// apiImport imports the records of the body in the format query, the file part of a multipart body
+// included, into the bucket query like a/b. The mode query merge (by default) keeps the keys not imported,
+// replace deletes them. With the dryRun query it only tells what would change.
+func apiImport(c *gin.Context) {
+	bucket := boltcli.ParsePath(c.Query("bucket"))
+	mode := c.DefaultQuery("mode", ImportMerge)
+	if mode != ImportMerge && mode != ImportReplace {
+		badRequest(c, "mode should be merge or replace")
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	body, filename, err := requestBody(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(filename), ".")
+	}
+	if format == "" {
+		format = FormatNDJSON
+	}
+	if _, ok := formatTypes[format]; !ok {
+		badRequest(c, "format should be ndjson, json or csv")
+		return
+	}
+
+	limited := &io.LimitedReader{R: auditReader(c, body), N: maxImportSize + 1}
+	items, err := readImport(limited, format, len(bucket) == 0)
+	if limited.N <= 0 {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": APIError{Code: CodeTooLarge,
+			Message: fmt.Sprintf("import too large, the limit is %d bytes", maxImportSize)}})
+		return
+	}
+	if errors.Is(err, errTooLarge) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": APIError{Code: CodeTooLarge, Message: err.Error()}})
+		return
+	}
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	result := &ImportResult{Bucket: boltcli.FormatPath(bucket), Format: format, Mode: mode, DryRun: dryRun,
+		Records: len(items), Changes: []ImportChange{}}
+	if err := applyImport(c, bucket, items, result); err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// readImport reads the records of the format, the root keeps only the buckets, so atRoot needs the records
+// to be in a bucket.
+func readImport(r io.Reader, format string, atRoot bool) ([]importItem, error) {
+	var items []importItem
+	add := func(n int, rec ExportRecord) error {
+		path, k, v, err := rec.decode()
+		switch {
+		case err != nil:
+		case len(k) == 0:
+			err = errors.New("no key")
+		case atRoot && len(path) == 0:
+			err = errors.New("no bucket for a key at the root")
+		case int64(len(v)) > maxValueSize:
+			err = fmt.Errorf("%w, the limit is %d bytes", errTooLarge, maxValueSize)
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+
+		items = append(items, importItem{path: path, key: k, value: v})
+		return nil
+	}
+
+	switch format {
+	case FormatCSV:
+		return items, readCSVImport(r, add)
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+			return nil, errors.New("the JSON import should be an array of records")
+		}
+		for n := 1; dec.More(); n++ {
+			var rec ExportRecord
+			if err := dec.Decode(&rec); err != nil {
+				return nil, fmt.Errorf("record %d: %w", n, err)
+			}
+			if err := add(n, rec); err != nil {
+				return nil, err
+			}
+		}
+		_, err := dec.Token()
+		return items, err
+	default:
+		dec := json.NewDecoder(r)
+		for n := 1; ; n++ {
+			var rec ExportRecord
+			if err := dec.Decode(&rec); err == io.EOF {
+				return items, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("record %d: %w", n, err)
+			}
+			if err := add(n, rec); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func readCSVImport(r io.Reader, add func(n int, rec ExportRecord) error) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["key"]; !ok {
+		return errors.New("the CSV header has no key column")
+	}
+	if _, ok := columns["value"]; !ok {
+		return errors.New("the CSV header has no value column")
+	}
+
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	for n := 1; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rec := ExportRecord{Bucket: field(row, "bucket"), Key: field(row, "key"), Value: field(row, "value"),
+			Encoding: field(row, "encoding")}
+		if err := add(n, rec); err != nil {
+			return err
+		}
+	}
+}
+
+// planImport counts the keys added, updated, unchanged and, with the replace mode, deleted by the import
+// in the transaction of d. The existing keys are walked, not kept, only the imported ones are in memory.
+func planImport(d *boltcli.DB, bucket [][]byte, items []importItem, result *ImportResult) error {
+	// a key imported twice takes its last value.
+	last := map[string]int{}
+	for i, item := range items {
+		last[itemID(item.path, item.key)] = i
+	}
+
+	// updated tells the items found with another value, found the ones found.
+	found, updated := make([]bool, len(items)), make([]bool, len(items))
+	var deleted []ImportChange
+	if d.HasBucket(bucket) {
+		var names [][]byte
+		err := d.WithPath(bucket...).Tree(0, func(depth int, k, v []byte) bool {
+			if v == nil {
+				names = append(names[:depth-1], k)
+				return true
+			}
+
+			path := names[:depth-1]
+			i, ok := last[itemID(path, k)]
+			switch {
+			case ok:
+				found[i], updated[i] = true, !bytes.Equal(v, items[i].value)
+				if updated[i] {
+					result.Updated++
+				} else {
+					result.Unchanged++
+				}
+			case result.Mode == ImportReplace:
+				result.Deleted++
+				if len(deleted) < importChangeN {
+					deleted = append(deleted, newImportChange("delete", path, k))
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, item := range items {
+		switch {
+		case last[itemID(item.path, item.key)] != i:
+		case !found[i]:
+			result.Added++
+			result.change("add", item.path, item.key)
+		case updated[i]:
+			result.change("update", item.path, item.key)
+		}
+	}
+
+	for _, change := range deleted {
+		if len(result.Changes) < importChangeN {
+			result.Changes = append(result.Changes, change)
+		}
+	}
+
+	return nil
+}
+
+// itemID identifies a key by its path, the names are length prefixed to be unambiguous.
+func itemID(path [][]byte, k []byte) string {
+	var b strings.Builder
+	for _, name := range path {
+		b.WriteString(strconv.Itoa(len(name)))
+		b.WriteByte(':')
+		b.Write(name)
+	}
+	b.WriteString(strconv.Itoa(len(k)))
+	b.WriteByte(':')
+	b.Write(k)
+
+	return b.String()
+}
+
+// applyImport plans and writes the items in one transaction, after deleting the content of the bucket
+// with the replace mode. The dry run rolls the transaction back.
+func applyImport(c *gin.Context, bucket [][]byte, items []importItem, result *ImportResult) (err error) {
+	d := dbAt(c, nil)
+	if err := d.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil || result.DryRun {
+			d.Rollback()
+		}
+	}()
+
+	if err := planImport(d, bucket, items, result); err != nil {
+		return err
+	}
+
+	if result.Mode == ImportReplace {
+		if err := clearBucket(d, bucket); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range items {
+		path := append(append([][]byte{}, bucket...), item.path...)
+		if err := d.WithPath(path...).Put(item.key, item.value); err != nil {
+			return err
+		}
+	}
+
+	if result.DryRun {
+		return nil
+	}
+
+	_, err = d.Commit()
+	return err
+}
+
+// clearBucket deletes the bucket and creates it again empty, the root loses all its buckets.
+func clearBucket(d *boltcli.DB, bucket [][]byte) error {
+	if len(bucket) > 0 {
+		if d.HasBucket(bucket) {
+			if err := d.DelBucket(bucket[0], bucket[1:]...); err != nil {
+				return err
+			}
+		}
+		return d.NewBucket(bucket[0], bucket[1:]...)
+	}
+
+	buckets, err := d.GetBuckets()
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		if err := d.DelBucket(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
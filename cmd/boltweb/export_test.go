@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func putKeys(t *testing.T, path string, kvs ...string) {
+	d := *db
+	for i := 0; i+1 < len(kvs); i += 2 {
+		assert.Nil(t, d.WithPath(boltcli.ParsePath(path)...).Put([]byte(kvs[i]), []byte(kvs[i+1])))
+	}
+}
+
+// dumpKeys lists the keys below the bucket like a/b=v lines.
+func dumpKeys(t *testing.T, path string) string {
+	var lines, names []string
+	d := *db
+	err := d.WithPath(boltcli.ParsePath(path)...).Tree(0, func(depth int, k, v []byte) bool {
+		if v == nil {
+			names = append(names[:depth-1], string(k))
+		} else {
+			lines = append(lines, strings.Join(append(append([]string{}, names[:depth-1]...), string(k)), "/")+"="+string(v))
+		}
+		return true
+	})
+	assert.Nil(t, err)
+	return strings.Join(lines, "\n")
+}
+
+func TestExport(t *testing.T) {
+	r := newTestRouter(t)
+	putKeys(t, "app", "name", "boltweb")
+	putKeys(t, "app/cfg", "port", "8080", "\xff", "\x00\xfe")
+	d := *db
+	assert.Nil(t, d.WithPath([]byte("app"), []byte("a/b")).Put([]byte("k"), []byte("slash")))
+	putKeys(t, "other", "k", "v")
+
+	w := serve(r, "GET", "/api/v1/export?bucket=app", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=app.ndjson`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, `{"bucket":"a%2Fb","key":"k","value":"slash"}
+{"bucket":"cfg","key":"port","value":"8080"}
+{"bucket":"cfg","key":"/w==","value":"AP4=","encoding":"base64"}
+{"key":"name","value":"boltweb"}
+`, w.Body.String())
+
+	w = serve(r, "GET", "/api/v1/export?bucket=app/cfg&format=csv", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bucket,key,value,encoding\n,port,8080,\n,/w==,AP4=,base64\n", w.Body.String())
+
+	w = serve(r, "GET", "/api/v1/export?format=json", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var records []ExportRecord
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &records))
+	assert.Equal(t, 5, len(records))
+	assert.Equal(t, ExportRecord{Bucket: "other", Key: "k", Value: "v"}, records[4])
+
+	w = serve(r, "GET", "/api/v1/export?bucket=missing", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve(r, "GET", "/api/v1/export?format=xml", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the exports import back in all the formats.
+	for _, format := range []string{FormatNDJSON, FormatJSON, FormatCSV} {
+		w = serve(r, "GET", "/api/v1/export?bucket=app&format="+format, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = serve(r, "POST", "/api/v1/import?bucket=copy/"+format+"&format="+format, w.Body.String())
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, dumpKeys(t, "app"), dumpKeys(t, "copy/"+format))
+	}
+	assert.True(t, db.HasBucket([][]byte{[]byte("copy"), []byte("csv"), []byte("a/b")}))
+
+	assert.Equal(t, "a%2Fb", boltcli.EscapeName([]byte("a/b")))
+	assert.Equal(t, "%25%FFx", boltcli.EscapeName([]byte("%\xffx")))
+}
+
+func TestImport(t *testing.T) {
+	r := newTestRouter(t)
+	putKeys(t, "app", "a", "1", "b", "2", "c", "3")
+
+	body := `{"key":"a","value":"1"}
+{"key":"b","value":"20"}
+{"key":"d","value":"4"}
+{"bucket":"sub","key":"e","value":"5"}
+`
+	w := serve(r, "POST", "/api/v1/import?bucket=app&mode=replace&dryRun=true", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"bucket":"/app","format":"ndjson","mode":"replace","dryRun":true,
+		"records":4,"added":2,"updated":1,"unchanged":1,"deleted":1,"changes":[
+		{"op":"update","key":"b"},{"op":"add","key":"d"},{"op":"add","bucket":"sub","key":"e"},{"op":"delete","key":"c"}]}`,
+		w.Body.String())
+	assert.Equal(t, "a=1\nb=2\nc=3", dumpKeys(t, "app"))
+
+	w = serve(r, "POST", "/api/v1/import?bucket=app", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "a=1\nb=20\nc=3\nd=4\nsub/e=5", dumpKeys(t, "app"))
+
+	w = serve(r, "POST", "/api/v1/import?bucket=app&mode=replace", `{"key":"z","value":"26"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "z=26", dumpKeys(t, "app"))
+
+	// the multipart uploads tell the format by the file name.
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", "seed.csv")
+	assert.Nil(t, err)
+	fw.Write([]byte("key,value\nx,\"1,2\"\n"))
+	assert.Nil(t, mw.Close())
+	req := httptest.NewRequest("POST", "/api/v1/import?bucket=app", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "x=1,2\nz=26", dumpKeys(t, "app"))
+
+	// a bad record imports nothing.
+	w = serve(r, "POST", "/api/v1/import?bucket=app", `{"key":"y","value":"1"}`+"\n"+`{"key":"","value":"2"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "record 2: no key")
+	assert.Equal(t, "x=1,2\nz=26", dumpKeys(t, "app"))
+
+	for _, target := range []string{
+		"/api/v1/import?bucket=app&format=json",
+		"/api/v1/import?bucket=app&format=csv",
+		"/api/v1/import?bucket=app&mode=append",
+		"/api/v1/import",
+	} {
+		w = serve(r, "POST", target, `{"key":"k","value":"v"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
+
+	defer func(size int64) { maxImportSize = size }(maxImportSize)
+	maxImportSize = 10
+	w = serve(r, "POST", "/api/v1/import?bucket=app", `{"key":"k","value":"v"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/bingoohuang/boltcli"
@@ -10,12 +12,29 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var (
-	db     *boltcli.DB
-	dbName = os.Getenv("BOLTWEB_DB")
-	port   = os.Getenv("BOLTWEB_PORT")
+	db      *boltcli.DB
+	journal bool
+	dbName  = os.Getenv("BOLTWEB_DB")
+	port    = os.Getenv("BOLTWEB_PORT")
+
+	authModes, htpasswdFile, tokensFile, aclFile string
+	proxyHeader, proxyFrom                       string
+
+	serveConfig = ServeConfig{
+		Bind:     os.Getenv("BOLTWEB_BIND"),
+		Unix:     os.Getenv("BOLTWEB_UNIX"),
+		CertFile: os.Getenv("BOLTWEB_TLS_CERT"),
+		KeyFile:  os.Getenv("BOLTWEB_TLS_KEY"),
+		ClientCA: os.Getenv("BOLTWEB_TLS_CLIENT_CA"),
+	}
 )
 
 func init() {
@@ -27,6 +46,82 @@ func init() {
 	}
 	flag.StringVar(&dbName, "d", dbName, "Name of the database")
 	flag.StringVar(&port, "p", port, "Port for the web-ui")
+	flag.BoolVar(&journal, "journal", false, "Append the writes to the journal DB.journal for incremental backups")
+	flag.BoolVar(&audit, "audit", audit, "Append the write requests with their users to the audit log")
+	flag.StringVar(&auditFile, "audit-file", "", "Audit log `FILE` of JSON lines, DB.audit.jsonl by default")
+	flag.Int64Var(&maxValueSize, "max-value", maxValueSize, "Largest value in `BYTES` accepted by the API puts and uploads")
+	flag.Int64Var(&maxImportSize, "max-import", maxImportSize, "Largest import file in `BYTES`")
+	flag.DurationVar(&statsInterval, "stats-interval", statsInterval, "`INTERVAL` between the samples of the db statistics of the Stats page")
+	flag.IntVar(&statsSampleN, "stats-samples", statsSampleN, "Number of the db statistics samples kept")
+	flag.IntVar(&metricsBucketDepth, "metrics-bucket-depth", metricsBucketDepth, "`DEPTH` of the buckets whose keys are counted by /metrics, 0 for none")
+	flag.DurationVar(&metricsBucketInterval, "metrics-bucket-interval", metricsBucketInterval, "`INTERVAL` between the key counts of /metrics")
+	serveConfig.SelfSigned, _ = strconv.ParseBool(os.Getenv("BOLTWEB_TLS_SELF_SIGNED"))
+	flag.StringVar(&serveConfig.Bind, "bind", serveConfig.Bind, "`HOST` or IP to listen on, all the interfaces by default")
+	flag.StringVar(&serveConfig.Unix, "unix", serveConfig.Unix, "Listen on the unix socket `PATH` instead of the port")
+	flag.StringVar(&serveConfig.CertFile, "tls-cert", serveConfig.CertFile, "TLS certificate `FILE` to serve https")
+	flag.StringVar(&serveConfig.KeyFile, "tls-key", serveConfig.KeyFile, "TLS key `FILE` of the certificate")
+	flag.BoolVar(&serveConfig.SelfSigned, "tls-self-signed", serveConfig.SelfSigned,
+		"Serve https by a self signed certificate for local use, generated into -tls-cert and -tls-key when they do not exist")
+	flag.StringVar(&serveConfig.ClientCA, "tls-client-ca", serveConfig.ClientCA, "Require client certificates signed by the CA certificates of the `FILE`")
+	flag.StringVar(&authModes, "auth", "", "Comma separated authentication `MODES` basic, token or proxy, none by default")
+	flag.StringVar(&htpasswdFile, "htpasswd", "", "htpasswd `FILE` with bcrypt or {SHA} passwords for -auth basic")
+	flag.StringVar(&tokensFile, "tokens", "", "`FILE` of TOKEN USER lines for the bearer tokens of -auth token")
+	flag.StringVar(&proxyHeader, "proxy-header", "X-Forwarded-User", "`HEADER` with the user set by the reverse proxy for -auth proxy")
+	flag.StringVar(&proxyFrom, "proxy-from", "127.0.0.1,::1", "Comma separated `CIDRS` of the reverse proxies trusted by -auth proxy")
+	flag.StringVar(&aclFile, "acl", "", "`FILE` of USER ROLE [BUCKET_PREFIX] lines with the roles read-only, writer or admin, "+
+		"all the authenticated users are admins without it")
+}
+
+// newAuth creates the authentication of the flags, nil when it is disabled.
+func newAuth() (*Auth, error) {
+	if authModes == "" {
+		if aclFile != "" {
+			return nil, errors.New("-acl needs an authentication by -auth")
+		}
+		return nil, nil
+	}
+
+	a := &Auth{}
+	for _, mode := range strings.Split(authModes, ",") {
+		switch mode = strings.TrimSpace(mode); mode {
+		case "basic":
+			if htpasswdFile == "" {
+				return nil, errors.New("-auth basic needs -htpasswd")
+			}
+			h, err := LoadHtpasswd(htpasswdFile)
+			if err != nil {
+				return nil, err
+			}
+			a.Authenticators, a.Basic = append(a.Authenticators, h), true
+		case "token":
+			if tokensFile == "" {
+				return nil, errors.New("-auth token needs -tokens")
+			}
+			t, err := LoadTokens(tokensFile)
+			if err != nil {
+				return nil, err
+			}
+			a.Authenticators = append(a.Authenticators, t)
+		case "proxy":
+			p, err := NewProxyHeader(proxyHeader, proxyFrom)
+			if err != nil {
+				return nil, err
+			}
+			a.Authenticators = append(a.Authenticators, p)
+		default:
+			return nil, fmt.Errorf("unknown -auth mode %q", mode)
+		}
+	}
+
+	if aclFile != "" {
+		acl, err := LoadACL(aclFile)
+		if err != nil {
+			return nil, err
+		}
+		a.ACL = acl
+	}
+
+	return a, nil
 }
 
 func main() {
@@ -43,19 +138,73 @@ func main() {
 		os.Exit(1)
 	}
 
+	if statsInterval <= 0 {
+		fmt.Println("-stats-interval should be positive, got", statsInterval)
+		os.Exit(1)
+	}
+
 	fmt.Print(" ")
 	log.Print("starting boltdb-browser..")
 
 	var err error
-	db, err = boltcli.New(dbName)
+	if auth, err = newAuth(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var fns []boltcli.OptionFn
+	if journal {
+		fns = append(fns, boltcli.WithJournal(boltcli.JournalDir(dbName)))
+	}
+
+	db, err = boltcli.New(dbName, fns...)
 
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
+	if audit {
+		if auditFile == "" {
+			auditFile = dbName + ".audit.jsonl"
+		}
+		if auditLog, err = OpenAuditLog(auditFile); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer auditLog.Close()
+	}
+
 	// OK, we should be ready to define/run web server safely.
+	serveConfig.Port = port
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stats = NewStatsRing(statsSampleN)
+	go stats.Sample(ctx, statsInterval)
+
+	err = serveConfig.Serve(ctx, newRouter())
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Print(err)
+		os.Exit(1)
+	}
+
+	log.Printf("closed %s", dbName)
+}
+
+func newRouter() *gin.Engine {
 	r := gin.Default()
+	requests := NewRequestMetrics()
+	r.Use(requests.Middleware)
+	// the audit log comes before the authentication to log the forbidden writes too.
+	r.Use(auditWrites)
+	if auth != nil {
+		r.Use(auth.Middleware)
+	}
+
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "pong",
@@ -70,9 +219,17 @@ func main() {
 	r.POST("/deleteKey", DeleteKey)
 	r.POST("/deleteBucket", DeleteBucket)
 	r.POST("/prefixScan", PrefixScan)
+	r.GET("/info", DbInfo)
+	r.GET("/analyze", DbAnalyze)
+	r.GET("/history", History)
+	r.POST("/revert", Revert)
+	r.POST("/versions", Versions)
+	r.GET("/metrics", metricsHandler(requests,
+		&boltcli.Metrics{DB: db, BucketDepth: metricsBucketDepth, BucketInterval: metricsBucketInterval}))
 	r.StaticFS("/web", http.FS(sub))
+	registerAPI(r)
 
-	r.Run(":" + port)
+	return r
 }
 
 //go:embed web
@@ -89,6 +246,7 @@ func CreateBucket(c *gin.Context) {
 	bucket := c.PostForm("bucket")
 	if bucket == "" {
 		c.String(200, "no bucket name | n")
+		return
 	}
 
 	err := db.NewBucket([]byte(bucket))
@@ -103,6 +261,7 @@ func DeleteBucket(c *gin.Context) {
 	bucket := c.PostForm("bucket")
 	if bucket == "" {
 		c.String(200, "no bucket name | n")
+		return
 	}
 
 	err := db.DelBucket([]byte(bucket))
@@ -118,9 +277,10 @@ func DeleteKey(c *gin.Context) {
 	key := c.PostForm("key")
 	if bucket == "" || key == "" {
 		c.String(200, "no bucket name or key | n")
+		return
 	}
 
-	err := db.WithBucket([]byte(bucket)).Del([]byte(key))
+	err := dbAt(c, [][]byte{[]byte(bucket)}).Del([]byte(key))
 	if err != nil {
 		c.String(200, err.Error())
 		return
@@ -134,10 +294,11 @@ func Put(c *gin.Context) {
 	key := c.PostForm("key")
 	if bucket == "" || key == "" {
 		c.String(200, "no bucket name or key | n")
+		return
 	}
 
 	value := c.PostForm("value")
-	err := db.WithBucket([]byte(bucket)).Put([]byte(key), []byte(value))
+	err := dbAt(c, [][]byte{[]byte(bucket)}).Put([]byte(key), []byte(value))
 	if err != nil {
 		c.String(200, err.Error())
 		return
@@ -151,9 +312,10 @@ func Get(c *gin.Context) {
 	key := c.PostForm("key")
 	if bucket == "" || key == "" {
 		c.String(200, "no bucket name or key | n")
+		return
 	}
 
-	value, err := db.WithBucket([]byte(bucket)).Get([]byte(key))
+	value, err := dbAt(c, [][]byte{[]byte(bucket)}).Get([]byte(key))
 	if err != nil {
 		c.JSON(200, []string{"nok", err.Error()})
 		return
@@ -175,17 +337,18 @@ func PrefixScan(c *gin.Context) {
 	if bucket == "" {
 		res.Result = "no bucket name | n"
 		c.JSON(200, res)
+		return
 	}
 
 	key := c.PostForm("key")
 	var err error
 	if key == "" {
-		err = db.WithBucket([]byte(bucket)).List(func(index int, k, v []byte) bool {
+		err = dbAt(c, [][]byte{[]byte(bucket)}).List(func(index int, k, v []byte) bool {
 			m[string(k)] = string(v)
 			return index < 2000
 		})
 	} else {
-		err = db.WithBucket([]byte(bucket)).PrefixList([]byte(key), func(index int, k, v []byte) bool {
+		err = dbAt(c, [][]byte{[]byte(bucket)}).PrefixList([]byte(key), func(index int, k, v []byte) bool {
 			m[string(k)] = string(v)
 			return index < 2000
 		})
@@ -203,8 +366,107 @@ func Buckets(c *gin.Context) {
 	var res []string
 	buckets, _ := db.GetBuckets()
 	for _, b := range buckets {
-		res = append(res, string(b))
+		if canRead(c, [][]byte{b}) {
+			res = append(res, string(b))
+		}
 	}
 
 	c.JSON(200, res)
 }
+
+func DbInfo(c *gin.Context) {
+	info, err := db.Info(10)
+	if err != nil {
+		c.JSON(200, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, info)
+}
+
+// DbAnalyze analyzes the bucket, a nested bucket like a/b, with the optional top and depth.
+func DbAnalyze(c *gin.Context) {
+	top, _ := strconv.Atoi(c.Query("top"))
+	depth, _ := strconv.Atoi(c.Query("depth"))
+	a, err := db.Analyze(boltcli.ParsePath(c.Query("bucket")), boltcli.AnalyzeOption{Top: top, Depth: depth})
+	if err != nil {
+		c.JSON(200, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, a)
+}
+
+// VersionView is a version of a key with the value as a string.
+type VersionView struct {
+	Version uint64    `json:"version"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Op      string    `json:"op"`
+	Value   string    `json:"value"`
+}
+
+// History lists the versions of the key in the bucket, the latest first, with the version limit of the bucket.
+func History(c *gin.Context) {
+	bdb := dbAt(c, [][]byte{[]byte(c.Query("bucket"))})
+	limit, err := bdb.VersionLimit()
+	if err != nil {
+		c.JSON(200, gin.H{"error": err.Error(), "versioned": false})
+		return
+	}
+
+	versions, err := bdb.History([]byte(c.Query("key")))
+	if err != nil {
+		c.JSON(200, gin.H{"error": err.Error()})
+		return
+	}
+
+	views := make([]VersionView, 0, len(versions))
+	for _, v := range versions {
+		views = append(views, VersionView{Version: v.Version, Time: v.Time, User: v.User, Op: v.Op, Value: string(v.Value)})
+	}
+
+	c.JSON(200, gin.H{"versioned": true, "limit": limit, "versions": views})
+}
+
+func Revert(c *gin.Context) {
+	bucket := c.PostForm("bucket")
+	key := c.PostForm("key")
+	version, err := strconv.ParseUint(c.PostForm("version"), 10, 64)
+	if bucket == "" || key == "" || err != nil {
+		c.String(200, "no bucket name, key or version | n")
+		return
+	}
+
+	if _, err := dbAt(c, [][]byte{[]byte(bucket)}).Revert([]byte(key), version); err != nil {
+		c.String(200, err.Error())
+		return
+	}
+
+	c.String(200, "ok")
+}
+
+// Versions enables the versions of the bucket with the limit per key, 0 for no limit, or disables them with off.
+func Versions(c *gin.Context) {
+	bucket := c.PostForm("bucket")
+	if bucket == "" {
+		c.String(200, "no bucket name | n")
+		return
+	}
+
+	var err error
+	if limit := c.PostForm("limit"); limit == "off" {
+		err = dbAt(c, [][]byte{[]byte(bucket)}).DisableVersions()
+	} else if n, perr := strconv.Atoi(limit); perr != nil || n < 0 {
+		err = fmt.Errorf("bad version limit %q", limit)
+	} else {
+		err = dbAt(c, [][]byte{[]byte(bucket)}).EnableVersions(n)
+	}
+
+	if err != nil {
+		c.String(200, err.Error())
+		return
+	}
+
+	c.String(200, "ok")
+}
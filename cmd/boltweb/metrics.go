@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/gin-gonic/gin"
+)
+
+// metricsBucketDepth is the depth of the buckets whose keys are counted by /metrics, and metricsBucketInterval
+// the time between their samples, see -metrics-bucket-depth and -metrics-bucket-interval.
+var (
+	metricsBucketDepth    = 1
+	metricsBucketInterval = time.Minute
+)
+
+// requestBounds are the upper bounds in seconds of the buckets of the request durations.
+var requestBounds = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// RequestMetrics counts the requests per route and status, with their durations per route.
+type RequestMetrics struct {
+	mu     sync.Mutex
+	counts map[requestCount]uint64
+	routes map[requestRoute]*requestDurations
+}
+
+type requestRoute struct {
+	method, route string
+}
+
+type requestCount struct {
+	requestRoute
+	code int
+}
+
+// requestDurations counts the durations in each bucket of requestBounds, the last one for the longer durations.
+type requestDurations struct {
+	counts []uint64
+	sum    float64
+}
+
+// NewRequestMetrics returns the metrics of no request yet.
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{counts: map[requestCount]uint64{}, routes: map[requestRoute]*requestDurations{}}
+}
+
+// requestMethods are the methods counted by their name, the others are counted as OTHER,
+// so the clients cannot make up any number of labels.
+var requestMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// Middleware counts the requests by their method and route pattern, the requests matching no route as unmatched.
+func (m *RequestMetrics) Middleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	method, route := c.Request.Method, c.FullPath()
+	if !requestMethods[method] {
+		method = "OTHER"
+	}
+	if route == "" {
+		route = "unmatched"
+	}
+	m.Observe(method, route, c.Writer.Status(), time.Since(start))
+}
+
+// Observe counts a request.
+func (m *RequestMetrics) Observe(method, route string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := requestRoute{method: method, route: route}
+	m.counts[requestCount{requestRoute: r, code: code}]++
+
+	durations := m.routes[r]
+	if durations == nil {
+		durations = &requestDurations{counts: make([]uint64, len(requestBounds)+1)}
+		m.routes[r] = durations
+	}
+
+	seconds := d.Seconds()
+	durations.counts[sort.SearchFloat64s(requestBounds, seconds)]++
+	durations.sum += seconds
+}
+
+// Write writes the request metrics sorted by route.
+func (m *RequestMetrics) Write(p *boltcli.PromWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make([]requestCount, 0, len(m.counts))
+	for k := range m.counts {
+		counts = append(counts, k)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.requestRoute != b.requestRoute {
+			return a.route < b.route || a.route == b.route && a.method < b.method
+		}
+		return a.code < b.code
+	})
+
+	p.Family("boltweb_http_requests_total", "counter", "Number of HTTP requests by route and status code.")
+	for _, k := range counts {
+		p.Sample("boltweb_http_requests_total", float64(m.counts[k]),
+			"method", k.method, "route", k.route, "code", strconv.Itoa(k.code))
+	}
+
+	routes := make([]requestRoute, 0, len(m.routes))
+	for k := range m.routes {
+		routes = append(routes, k)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].route < routes[j].route || routes[i].route == routes[j].route && routes[i].method < routes[j].method
+	})
+
+	p.Family("boltweb_http_request_duration_seconds", "histogram", "Duration of the HTTP requests by route.")
+	for _, k := range routes {
+		d := m.routes[k]
+		p.Histogram("boltweb_http_request_duration_seconds", requestBounds, d.counts, d.sum, "method", k.method, "route", k.route)
+	}
+}
+
+// metricsHandler serves the request metrics and the metrics of the db in the Prometheus text format.
+func metricsHandler(requests *RequestMetrics, m *boltcli.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", boltcli.PromContentType)
+		p := boltcli.NewPromWriter(c.Writer)
+		requests.Write(p)
+		m.Write(p)
+		_ = p.Flush()
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	r := newTestRouter(t)
+	putKeys(t, "a/b", "k", "v")
+
+	assert.Equal(t, http.StatusOK, serve(r, "PUT", "/api/v1/buckets/a/keys/k", "v").Code)
+	assert.Equal(t, http.StatusOK, serve(r, "GET", "/api/v1/buckets/a/keys/k", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(r, "GET", "/api/v1/buckets/a/keys/missing", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(r, "GET", "/nope", "").Code)
+	for _, method := range []string{"FOO", "BAR1", "X-Y"} {
+		serve(r, method, "/api/v1/buckets/a/keys/k", "")
+	}
+
+	w := serve(r, "GET", "/metrics", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, boltcli.PromContentType, w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(t, body, `boltweb_http_requests_total{method="GET",route="/api/v1/buckets/*path",code="200"} 1
+boltweb_http_requests_total{method="GET",route="/api/v1/buckets/*path",code="404"} 1
+boltweb_http_requests_total{method="PUT",route="/api/v1/buckets/*path",code="200"} 1
+boltweb_http_requests_total{method="GET",route="unmatched",code="404"} 1
+`)
+	assert.Contains(t, body, `boltweb_http_request_duration_seconds_count{method="GET",route="/api/v1/buckets/*path"} 2`)
+	// the made up methods share one label.
+	assert.Contains(t, body, `boltweb_http_request_duration_seconds_count{method="OTHER",route="unmatched"} 3`)
+	assert.NotContains(t, body, `method="FOO"`)
+	assert.Contains(t, body, "# TYPE bolt_tx_writes_total counter\n")
+	assert.Contains(t, body, `bolt_bucket_keys{bucket="/a"} 3`)
+	assert.NotContains(t, body, `bucket="/a/b"`)
+}
+
+func TestRequestMetrics(t *testing.T) {
+	m := NewRequestMetrics()
+	m.Observe("GET", "/r", 200, 3*time.Millisecond)
+	m.Observe("GET", "/r", 500, 10*time.Millisecond)
+	m.Observe("GET", "/r", 200, time.Minute)
+
+	var buf bytes.Buffer
+	p := boltcli.NewPromWriter(&buf)
+	m.Write(p)
+	assert.Nil(t, p.Flush())
+	assert.Contains(t, buf.String(), `boltweb_http_requests_total{method="GET",route="/r",code="200"} 2
+boltweb_http_requests_total{method="GET",route="/r",code="500"} 1
+`)
+	assert.Contains(t, buf.String(), `boltweb_http_request_duration_seconds_bucket{method="GET",route="/r",le="0.005"} 1
+boltweb_http_request_duration_seconds_bucket{method="GET",route="/r",le="0.01"} 2
+`)
+	assert.Contains(t, buf.String(), `boltweb_http_request_duration_seconds_bucket{method="GET",route="/r",le="10"} 2
+boltweb_http_request_duration_seconds_bucket{method="GET",route="/r",le="+Inf"} 3
+boltweb_http_request_duration_seconds_sum{method="GET",route="/r"} 60.013
+boltweb_http_request_duration_seconds_count{method="GET",route="/r"} 3
+`)
+}
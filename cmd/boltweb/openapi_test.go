@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOpenAPIRoutes checks the OpenAPI document describes exactly the /api routes of gin.
+func TestOpenAPIRoutes(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := serve(r, "GET", "/api/openapi.json", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.True(t, strings.HasPrefix(doc.OpenAPI, "3."))
+
+	param := regexp.MustCompile(`{(\w+)}`)
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		ginPath := param.ReplaceAllString(path, ":$1")
+		if raw, ok := item["x-gin-path"]; ok {
+			assert.Nil(t, json.Unmarshal(raw, &ginPath))
+		}
+
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				documented[strings.ToUpper(method)+" "+ginPath] = true
+			}
+		}
+	}
+
+	routed := map[string]bool{}
+	for _, route := range r.Routes() {
+		if strings.HasPrefix(route.Path, "/api/") {
+			routed[route.Method+" "+route.Path] = true
+		}
+	}
+
+	assert.Equal(t, keys(routed), keys(documented))
+}
+
+func keys(m map[string]bool) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+
+	sort.Strings(ks)
+	return ks
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ShutdownTimeout is the time the requests in flight have to finish on shutdown.
+const ShutdownTimeout = 10 * time.Second
+
+// ServeConfig is where and how boltweb listens.
+type ServeConfig struct {
+	// Bind is the host or IP to listen on, all the interfaces when empty.
+	Bind string
+	Port string
+	// Unix is the path of a unix socket to listen on instead of the TCP port.
+	Unix string
+	// CertFile and KeyFile enable the TLS, SelfSigned generates them when they do not exist,
+	// or in memory when they are empty.
+	CertFile, KeyFile string
+	SelfSigned        bool
+	// ClientCA requires the client certificates signed by one of the CA certificates of the file.
+	ClientCA string
+}
+
+func (sc *ServeConfig) tls() bool { return sc.CertFile != "" || sc.SelfSigned }
+
+// Listen listens on the unix socket or on the TCP address of the config.
+func (sc *ServeConfig) Listen() (net.Listener, error) {
+	if sc.Unix == "" {
+		return net.Listen("tcp", net.JoinHostPort(sc.Bind, sc.Port))
+	}
+
+	// a socket left by a crash refuses the connections, another boltweb on it does not.
+	if _, err := os.Stat(sc.Unix); err == nil {
+		if conn, err := net.Dial("unix", sc.Unix); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("unix socket %s is in use", sc.Unix)
+		}
+		if err := os.Remove(sc.Unix); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", sc.Unix)
+}
+
+// TLSConfig returns the TLS config of the server, nil without TLS.
+func (sc *ServeConfig) TLSConfig() (*tls.Config, error) {
+	if !sc.tls() {
+		if sc.ClientCA != "" {
+			return nil, errors.New("the client CA needs the TLS, see -tls-cert or -tls-self-signed")
+		}
+		return nil, nil
+	}
+
+	cert, err := sc.certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if sc.ClientCA != "" {
+		data, err := os.ReadFile(sc.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificate in client CA %s", sc.ClientCA)
+		}
+		cfg.ClientCAs, cfg.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+func (sc *ServeConfig) certificate() (tls.Certificate, error) {
+	if !sc.SelfSigned {
+		return tls.LoadX509KeyPair(sc.CertFile, sc.KeyFile)
+	}
+
+	if sc.CertFile != "" && sc.KeyFile == "" {
+		return tls.Certificate{}, errors.New("the self signed cert file needs a key file")
+	}
+
+	// the generated cert is kept, so a browser trusting it once keeps trusting it.
+	if sc.CertFile != "" {
+		if _, err := os.Stat(sc.CertFile); err == nil {
+			return tls.LoadX509KeyPair(sc.CertFile, sc.KeyFile)
+		}
+	}
+
+	certPEM, keyPEM, err := SelfSignedCert(sc.hosts())
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if sc.CertFile != "" {
+		if err := os.WriteFile(sc.KeyFile, keyPEM, 0600); err != nil {
+			return tls.Certificate{}, err
+		}
+		if err := os.WriteFile(sc.CertFile, certPEM, 0644); err != nil {
+			return tls.Certificate{}, err
+		}
+		log.Printf("generated the self signed certificate %s with the key %s", sc.CertFile, sc.KeyFile)
+	}
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// hosts are the names of the self signed certificate, localhost and the bind address.
+func (sc *ServeConfig) hosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if sc.Bind != "" && sc.Bind != "0.0.0.0" && sc.Bind != "::" {
+		hosts = append(hosts, sc.Bind)
+	}
+	if h, err := os.Hostname(); err == nil {
+		hosts = append(hosts, h)
+	}
+
+	return hosts
+}
+
+// SelfSignedCert generates a self signed ECDSA server certificate valid for a year for the host names and IPs,
+// it returns the PEM encoded certificate and key. It is a leaf which cannot sign, so not a client CA.
+func SelfSignedCert(hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"boltweb self signed"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// Serve serves the handler until ctx is done, then shuts down gracefully, waiting for the requests
+// in flight up to ShutdownTimeout, and removes the unix socket.
+func (sc *ServeConfig) Serve(ctx context.Context, handler http.Handler) error {
+	tlsConfig, err := sc.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	ln, err := sc.Listen()
+	if err != nil {
+		return err
+	}
+	if sc.Unix != "" {
+		defer os.Remove(sc.Unix)
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		ln, scheme = tls.NewListener(ln, tlsConfig), "https"
+	}
+	log.Printf("listening on %s://%s", scheme, ln.Addr())
+
+	srv := &http.Server{Handler: handler, TLSConfig: tlsConfig, ReadHeaderTimeout: 10 * time.Second}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Print("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	return srv.Shutdown(shutdownCtx)
+}
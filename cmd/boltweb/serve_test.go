@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startServe serves a ping handler by the config until the test ends, it returns the address.
+func startServe(t *testing.T, sc *ServeConfig) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "pong") })
+
+	if sc.Unix == "" {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		sc.Bind, sc.Port, _ = net.SplitHostPort(ln.Addr().String())
+		ln.Close()
+	}
+
+	go func() { done <- sc.Serve(ctx, handler) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.Nil(t, <-done)
+	})
+
+	addr := net.JoinHostPort(sc.Bind, sc.Port)
+	network := "tcp"
+	if sc.Unix != "" {
+		addr, network = sc.Unix, "unix"
+	}
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial(network, addr); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return addr
+}
+
+func tlsClient(roots []byte, certs ...tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(roots)
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}}
+}
+
+func get(client *http.Client, url string) (string, error) {
+	rsp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
+	return string(body), err
+}
+
+func TestServeSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	sc := &ServeConfig{SelfSigned: true, CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	addr := startServe(t, sc)
+
+	certPEM, err := os.ReadFile(sc.CertFile)
+	assert.Nil(t, err)
+	body, err := get(tlsClient(certPEM), "https://"+addr)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", body)
+
+	_, err = get(http.DefaultClient, "https://"+addr)
+	assert.NotNil(t, err)
+
+	// the generated files are kept.
+	cert, err := (&ServeConfig{SelfSigned: true, CertFile: sc.CertFile, KeyFile: sc.KeyFile}).certificate()
+	assert.Nil(t, err)
+	again, err := tls.LoadX509KeyPair(sc.CertFile, sc.KeyFile)
+	assert.Nil(t, err)
+	assert.Equal(t, again.Certificate, cert.Certificate)
+
+	// it is a server leaf, which cannot sign other certificates.
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.Nil(t, err)
+	assert.False(t, leaf.IsCA)
+	assert.Equal(t, x509.KeyUsage(0), leaf.KeyUsage&x509.KeyUsageCertSign)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, leaf.ExtKeyUsage)
+}
+
+// newTestCA generates a CA, it returns the PEM encoded CA certificate and a client certificate signed by it.
+func newTestCA(t *testing.T) ([]byte, tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test CA"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageCertSign, BasicConstraintsValid: true, IsCA: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	assert.Nil(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	assert.Nil(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "client"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	assert.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServeClientCA(t *testing.T) {
+	caPEM, clientCert := newTestCA(t)
+
+	dir := t.TempDir()
+	sc := &ServeConfig{
+		SelfSigned: true, CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem"),
+		ClientCA: writeFile(t, "ca.pem", string(caPEM)),
+	}
+	addr := startServe(t, sc)
+	certPEM, err := os.ReadFile(sc.CertFile)
+	assert.Nil(t, err)
+
+	_, err = get(tlsClient(certPEM), "https://"+addr)
+	assert.NotNil(t, err)
+
+	body, err := get(tlsClient(certPEM, clientCert), "https://"+addr)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", body)
+
+	_, err = (&ServeConfig{ClientCA: sc.ClientCA}).TLSConfig()
+	assert.NotNil(t, err)
+}
+
+func TestServeUnix(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "boltweb.sock")
+	// a socket left by a crash is replaced.
+	assert.Nil(t, os.WriteFile(sock, nil, 0600))
+
+	sc := &ServeConfig{Unix: sock}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "pong") })
+	go func() { done <- sc.Serve(ctx, handler) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+
+	var body string
+	var err error
+	for i := 0; i < 100; i++ {
+		if body, err = get(client, "http://boltweb/"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", body)
+
+	_, err = (&ServeConfig{Unix: sock}).Listen()
+	assert.NotNil(t, err)
+
+	cancel()
+	assert.Nil(t, <-done)
+	_, err = os.Stat(sock)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+// statsInterval is the time between the samples of the db statistics, statsSampleN the number of samples kept,
+// see -stats-interval and -stats-samples.
+var (
+	statsInterval = 10 * time.Second
+	statsSampleN  = 360
+)
+
+// stats keeps the samples of the db statistics of the server.
+var stats = NewStatsRing(statsSampleN)
+
+// StatsSample is a sample of the db statistics, the counters of Stats are totals since the db is opened.
+type StatsSample struct {
+	Time     time.Time  `json:"time"`
+	FileSize int64      `json:"fileSize"`
+	Stats    bolt.Stats `json:"stats"`
+}
+
+// sampleStats samples the statistics of the db now.
+func sampleStats() (StatsSample, error) {
+	s := StatsSample{Time: time.Now(), Stats: db.DB.Stats()}
+	fi, err := os.Stat(db.DbFile)
+	if err != nil {
+		return s, err
+	}
+
+	s.FileSize = fi.Size()
+	return s, nil
+}
+
+// StatsRing keeps the last samples of the db statistics, overwriting the oldest ones.
+type StatsRing struct {
+	mu      sync.Mutex
+	samples []StatsSample
+	next    int
+	full    bool
+}
+
+// NewStatsRing returns a ring of n samples.
+func NewStatsRing(n int) *StatsRing {
+	if n < 1 {
+		n = 1
+	}
+
+	return &StatsRing{samples: make([]StatsSample, n)}
+}
+
+// Add adds the sample, dropping the oldest one when the ring is full.
+func (r *StatsRing) Add(s StatsSample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % len(r.samples)
+	r.full = r.full || r.next == 0
+}
+
+// Samples returns the samples, the oldest first.
+func (r *StatsRing) Samples() []StatsSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]StatsSample{}, r.samples[:r.next]...)
+	}
+
+	return append(append([]StatsSample{}, r.samples[r.next:]...), r.samples[:r.next]...)
+}
+
+// Sample adds a sample of the db statistics every interval until the context is done.
+func (r *StatsRing) Sample(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if s, err := sampleStats(); err == nil {
+			r.Add(s)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// StatsView is the current statistics of the db file with the samples of the last ones.
+type StatsView struct {
+	File     string `json:"file"`
+	PageSize int    `json:"pageSize"`
+	// Interval is the seconds between the samples.
+	Interval float64       `json:"interval"`
+	Current  StatsSample   `json:"current"`
+	Samples  []StatsSample `json:"samples"`
+}
+
+func apiStats(c *gin.Context) {
+	current, err := sampleStats()
+	if err != nil {
+		apiError(c, err)
+		return
+	}
+
+	c.JSON(200, StatsView{
+		File: db.DbFile, PageSize: db.DB.Info().PageSize, Interval: statsInterval.Seconds(),
+		Current: current, Samples: stats.Samples(),
+	})
+}
+
+// BucketStat is the bolt statistics of a bucket, which include its nested buckets.
+type BucketStat struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+	KeyN  int    `json:"keyN"`
+	// Alloc is the bytes of the pages of the bucket, Inuse the bytes used of them.
+	Alloc int              `json:"alloc"`
+	Inuse int              `json:"inuse"`
+	Stats bolt.BucketStats `json:"stats"`
+}
+
+// BucketStatsView is the statistics of the buckets in depth first order, with the largest ones by Alloc.
+// Truncated tells the buckets beyond the limit are left out.
+type BucketStatsView struct {
+	Buckets   []BucketStat `json:"buckets"`
+	Largest   []BucketStat `json:"largest"`
+	Truncated bool         `json:"truncated,omitempty"`
+}
+
+// errStatsLimit stops the walk of the buckets at the limit.
+var errStatsLimit = errors.New("too many buckets")
+
+// apiBucketStats collects the statistics of up to limit buckets, 1000 by default, the user can read
+// down to the depth, 1 by default and 0 for all, with the top largest ones, 10 by default.
+// The statistics of a bucket walk all the pages of its nested buckets, so the deeper levels walk them again.
+func apiBucketStats(c *gin.Context) {
+	depth, err := strconv.Atoi(c.DefaultQuery("depth", "1"))
+	if err != nil || depth < 0 {
+		badRequest(c, "invalid depth "+c.Query("depth"))
+		return
+	}
+	top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if err != nil || top < 0 {
+		badRequest(c, "invalid top "+c.Query("top"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil || limit < 1 {
+		badRequest(c, "invalid limit "+c.Query("limit"))
+		return
+	}
+
+	view := BucketStatsView{Buckets: []BucketStat{}}
+	var walk func(path [][]byte, b *bolt.Bucket) error
+	walk = func(path [][]byte, b *bolt.Bucket) error {
+		if canRead(c, path) {
+			if len(view.Buckets) >= limit {
+				view.Truncated = true
+				return errStatsLimit
+			}
+
+			s := b.Stats()
+			view.Buckets = append(view.Buckets, BucketStat{
+				Path: boltcli.FormatPath(path), Depth: len(path), KeyN: s.KeyN,
+				Alloc: s.BranchAlloc + s.LeafAlloc, Inuse: s.BranchInuse + s.LeafInuse, Stats: s,
+			})
+		}
+		if depth > 0 && len(path) >= depth {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			return walk(append(path[:len(path):len(path)], k), b.Bucket(k))
+		})
+	}
+
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if boltcli.IsHiddenBucket(name) {
+				return nil
+			}
+			return walk([][]byte{name}, b)
+		})
+	})
+	if err != nil && err != errStatsLimit {
+		apiError(c, err)
+		return
+	}
+
+	view.Largest = append([]BucketStat{}, view.Buckets...)
+	sort.SliceStable(view.Largest, func(i, j int) bool { return view.Largest[i].Alloc > view.Largest[j].Alloc })
+	if len(view.Largest) > top {
+		view.Largest = view.Largest[:top]
+	}
+
+	c.JSON(200, view)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsRing(t *testing.T) {
+	r := NewStatsRing(3)
+	assert.Equal(t, []StatsSample{}, r.Samples())
+
+	at := func(i int) StatsSample { return StatsSample{FileSize: int64(i)} }
+	r.Add(at(1))
+	r.Add(at(2))
+	assert.Equal(t, []StatsSample{at(1), at(2)}, r.Samples())
+	r.Add(at(3))
+	r.Add(at(4))
+	r.Add(at(5))
+	assert.Equal(t, []StatsSample{at(3), at(4), at(5)}, r.Samples())
+}
+
+func TestAPIStats(t *testing.T) {
+	r := newTestRouter(t)
+	defer func(s *StatsRing) { stats = s }(stats)
+	stats = NewStatsRing(10)
+
+	putKeys(t, "small", "k", "v")
+	putKeys(t, "large/nested", "k", strings.Repeat("v", 10000))
+	putKeys(t, "large", "a", "1", "b", "2")
+	s, err := sampleStats()
+	assert.Nil(t, err)
+	stats.Add(s)
+
+	w := serve(r, "GET", "/api/v1/stats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var view StatsView
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &view))
+	assert.Equal(t, db.DbFile, view.File)
+	assert.Equal(t, 10.0, view.Interval)
+	assert.True(t, view.Current.FileSize > 0)
+	assert.True(t, view.Current.Stats.TxStats.Write > 0)
+	assert.Equal(t, 1, len(view.Samples))
+	assert.WithinDuration(t, time.Now(), view.Samples[0].Time, time.Minute)
+
+	w = serve(r, "GET", "/api/v1/stats/buckets?depth=0&top=2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var buckets BucketStatsView
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &buckets))
+	var paths, keyNs []string
+	for _, b := range buckets.Buckets {
+		paths = append(paths, b.Path)
+		keyNs = append(keyNs, b.Path+"="+strconv.Itoa(b.KeyN))
+	}
+	assert.Equal(t, []string{"/large", "/large/nested", "/small"}, paths)
+	// the key counts of bolt include the nested buckets.
+	assert.Equal(t, []string{"/large=4", "/large/nested=1", "/small=1"}, keyNs)
+	assert.Equal(t, 2, len(buckets.Largest))
+	assert.Equal(t, "/large", buckets.Largest[0].Path)
+	assert.True(t, buckets.Largest[0].Alloc >= buckets.Largest[1].Alloc)
+
+	w = serve(r, "GET", "/api/v1/stats/buckets", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &buckets))
+	assert.Equal(t, 2, len(buckets.Buckets))
+	assert.False(t, buckets.Truncated)
+
+	w = serve(r, "GET", "/api/v1/stats/buckets?depth=0&limit=2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	buckets = BucketStatsView{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &buckets))
+	assert.Equal(t, "/large/nested", buckets.Buckets[1].Path)
+	assert.Equal(t, 2, len(buckets.Buckets))
+	assert.True(t, buckets.Truncated)
+
+	w = serve(r, "GET", "/api/v1/stats/buckets?limit=0", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(r, "GET", "/api/v1/stats/buckets?top=x", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
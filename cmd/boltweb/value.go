@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listValueSize is the number of bytes of the values in the key lists, get a key for its whole value.
+const listValueSize = 4096
+
+// maxValueSize is the largest value accepted by a put or an upload, see -max-value.
+var maxValueSize int64 = 10 << 20
+
+// errTooLarge is a value over maxValueSize.
+var errTooLarge = errors.New("value too large")
+
+// KeyView is a key with its value, binary safe. Value is the value as text, nil when it is not valid UTF-8,
+// Base64 the value itself.
+type KeyView struct {
+	Key string `json:"key"`
+	// KeyBase64 is the key not valid UTF-8, whose invalid bytes are replaced in Key.
+	KeyBase64   []byte  `json:"keyBase64,omitempty"`
+	Value       *string `json:"value,omitempty"`
+	Base64      []byte  `json:"base64"`
+	ContentType string  `json:"contentType"`
+	Size        int     `json:"size"`
+	// Truncated tells the value is cut to its first bytes, in the key lists.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// newKeyView returns the view of the key with up to limit bytes of its value, 0 for no limit.
+func newKeyView(k, v []byte, limit int) KeyView {
+	view := KeyView{Key: string(k), ContentType: detectContentType(v), Size: len(v)}
+	if !utf8.Valid(k) {
+		view.Key, view.KeyBase64 = string(bytes.ToValidUTF8(k, []byte("�"))), k
+	}
+
+	if limit > 0 && len(v) > limit {
+		v, view.Truncated = v[:limit], true
+		// a cut text keeps its whole runes.
+		for i := 0; i < utf8.UTFMax-1 && len(v) > 0 && !utf8.Valid(v); i++ {
+			v = v[:len(v)-1]
+		}
+	}
+
+	view.Base64 = v
+	if utf8.Valid(v) {
+		s := string(v)
+		view.Value = &s
+	}
+
+	return view
+}
+
+// detectContentType detects the content type of the value like http.DetectContentType,
+// with application/json for the JSON objects and arrays.
+func detectContentType(v []byte) string {
+	if t := bytes.TrimSpace(v); len(t) > 0 && (t[0] == '{' || t[0] == '[') && json.Valid(t) {
+		return "application/json"
+	}
+
+	return http.DetectContentType(v)
+}
+
+// readValue reads the value to put from the request body up to maxValueSize, the file part of
+// a multipart/form-data body, or a JSON body checked to be valid.
+func readValue(c *gin.Context) ([]byte, error) {
+	body, _, err := requestBody(c)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := io.ReadAll(io.LimitReader(body, maxValueSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(value)) > maxValueSize {
+		return nil, fmt.Errorf("%w, the limit is %d bytes", errTooLarge, maxValueSize)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType == "application/json" && !json.Valid(value) {
+		return nil, errors.New("the value is not valid JSON")
+	}
+
+	return value, nil
+}
+
+// requestBody returns the request body, or the file part of a multipart/form-data body with its file name.
+func requestBody(c *gin.Context) (io.Reader, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return c.Request.Body, "", nil
+	}
+
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, "", errors.New("no file part in the multipart body")
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FormName() == "file" {
+			return part, part.FileName(), nil
+		}
+	}
+}
+
+// download sends the value as a file named by the key.
+func download(c *gin.Context, k, v []byte) {
+	name := string(bytes.ToValidUTF8(k, []byte("_")))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Data(http.StatusOK, detectContentType(v), v)
+}
@@ -0,0 +1,54 @@
+package boltcli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The codecs told by DetectCodec.
+const (
+	CodecJSON   = "json"
+	CodecText   = "text"
+	CodecBinary = "binary"
+)
+
+// DetectCodec tells how a value is encoded, JSON objects and arrays,
+// printable UTF-8 text, or binary otherwise.
+func DetectCodec(v []byte) string {
+	trimmed := bytes.TrimSpace(v)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return CodecJSON
+	}
+
+	if !utf8.Valid(v) {
+		return CodecBinary
+	}
+
+	for _, r := range string(v) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return CodecBinary
+		}
+	}
+
+	return CodecText
+}
+
+// Pretty formats a value by its detected codec, indented JSON,
+// text as it is or a hex dump for binary values.
+func Pretty(v []byte) string {
+	switch DetectCodec(v) {
+	case CodecJSON:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, bytes.TrimSpace(v), "", "  "); err == nil {
+			return buf.String()
+		}
+		return string(v)
+	case CodecText:
+		return string(v)
+	default:
+		return hex.Dump(v)
+	}
+}
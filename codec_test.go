@@ -0,0 +1,17 @@
+package boltcli
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDetectCodec(t *testing.T) {
+	assert.Equal(t, CodecJSON, DetectCodec([]byte(` {"name":"bingoo"}`)))
+	assert.Equal(t, CodecText, DetectCodec([]byte(`{"name":`)))
+	assert.Equal(t, CodecText, DetectCodec([]byte("黄\tbingoo\n")))
+	assert.Equal(t, CodecBinary, DetectCodec([]byte{0x00, 0x2a}))
+	assert.Equal(t, CodecBinary, DetectCodec([]byte{0xff, 0xfe}))
+
+	assert.Equal(t, "{\n  \"a\": 1\n}", Pretty([]byte(`{"a":1}`)))
+	assert.Equal(t, "00000000  00 2a                                             |.*|\n", Pretty([]byte{0x00, 0x2a}))
+}
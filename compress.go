@@ -0,0 +1,87 @@
+package boltcli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The compressions of the backups, the others are added by RegisterCompression.
+const (
+	CompressNone = ""
+	CompressGzip = "gzip"
+)
+
+var ErrUnknownCompression = errors.New("unknown compression")
+
+// Compression is a compression of the backups told by its Name.
+type Compression struct {
+	Name string
+	// Ext is the file name extension, Magic the bytes the compressed stream starts with.
+	Ext   string
+	Magic []byte
+	// NewWriter compresses into w, Close flushes the stream but does not close w.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	// NewReader decompresses r, Close does not close r.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var compressions = map[string]Compression{
+	CompressGzip: {
+		Name: CompressGzip, Ext: ".gz", Magic: []byte{0x1f, 0x8b},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	},
+}
+
+// RegisterCompression adds a compression, or replaces the one of the same name.
+// It is meant to be called at the start of the program, before any backup.
+func RegisterCompression(c Compression) { compressions[c.Name] = c }
+
+// CompressionExt is the file name extension of the compression.
+func CompressionExt(compression string) string { return compressions[compression].Ext }
+
+// DetectCompression tells the compression by the magic bytes at the start of a file.
+func DetectCompression(head []byte) string {
+	for name, c := range compressions {
+		if bytes.HasPrefix(head, c.Magic) {
+			return name
+		}
+	}
+
+	return CompressNone
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewCompressWriter compresses into w, Close flushes the compressed stream but does not close w.
+func NewCompressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	if compression == CompressNone {
+		return nopWriteCloser{w}, nil
+	}
+
+	c, ok := compressions[compression]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCompression, compression)
+	}
+
+	return c.NewWriter(w)
+}
+
+// NewDecompressReader decompresses r, Close does not close r.
+func NewDecompressReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	if compression == CompressNone {
+		return io.NopCloser(r), nil
+	}
+
+	c, ok := compressions[compression]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCompression, compression)
+	}
+
+	return c.NewReader(r)
+}
@@ -0,0 +1,187 @@
+package boltcli
+
+import (
+	"errors"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+// KeyValue is a key and its value.
+type KeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// BucketNode is an in-memory copy of a bucket with its keys, sequence and nested buckets.
+type BucketNode struct {
+	Name    []byte        `json:"name"`
+	Seq     uint64        `json:"seq"`
+	Items   []KeyValue    `json:"items,omitempty"`
+	Buckets []*BucketNode `json:"buckets,omitempty"`
+}
+
+func readBucketNode(name []byte, b *bolt.Bucket) *BucketNode {
+	n, _ := readBucketNodeMax(name, b, -1)
+	return n
+}
+
+// readBucketNodeMax reads the bucket unless its names, keys and values are more than max bytes,
+// negative for no limit. It returns nil and false when the bucket is too large.
+func readBucketNodeMax(name []byte, b *bolt.Bucket, max int64) (*BucketNode, bool) {
+	left := max
+	var read func(name []byte, b *bolt.Bucket) *BucketNode
+	read = func(name []byte, b *bolt.Bucket) *BucketNode {
+		n := &BucketNode{Name: CloneBytes(name), Seq: b.Sequence()}
+		cursor := b.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			if max >= 0 {
+				if left -= int64(len(k) + len(v)); left < 0 {
+					return nil
+				}
+			}
+
+			if v == nil {
+				sub := read(k, b.Bucket(k))
+				if sub == nil {
+					return nil
+				}
+				n.Buckets = append(n.Buckets, sub)
+			} else {
+				n.Items = append(n.Items, KeyValue{Key: CloneBytes(k), Value: CloneBytes(v)})
+			}
+		}
+
+		return n
+	}
+
+	n := read(name, b)
+	return n, n != nil
+}
+
+// writeTo writes the keys, sequence and nested buckets of n into b, returning the number of keys written.
+func (n *BucketNode) writeTo(b *bolt.Bucket) (int, error) {
+	count := 0
+	for _, kv := range n.Items {
+		if err := b.Put(kv.Key, kv.Value); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	for _, sub := range n.Buckets {
+		child, err := b.CreateBucketIfNotExists(sub.Name)
+		if err != nil {
+			return count, err
+		}
+
+		cnt, err := sub.writeTo(child)
+		if count += cnt; err != nil {
+			return count, err
+		}
+	}
+
+	return count, b.SetSequence(n.Seq)
+}
+
+// Copy copies the key or the whole bucket at srcPath of src to dstPath of dst,
+// returning the number of copied keys. A key copied onto an existing bucket keeps its name
+// inside that bucket, while a bucket copied onto an existing bucket is merged into it,
+// and an empty dstPath keeps the source name. The writes are recorded like the ones of Put.
+// The source is read into memory first, so src and dst may be the same DB.
+func Copy(dst *DB, dstPath [][]byte, src *DB, srcPath [][]byte) (int, error) {
+	if len(srcPath) == 0 {
+		return 0, bolt.ErrBucketNameRequired
+	}
+
+	name := srcPath[len(srcPath)-1]
+	var node *BucketNode
+	var value []byte
+
+	err := src.view(func(tx *bolt.Tx) error {
+		if b := bucketAt(tx, srcPath); b != nil {
+			node = readBucketNode(name, b)
+			return nil
+		}
+
+		parent := bucketAt(tx, srcPath[:len(srcPath)-1])
+		if parent == nil {
+			return ErrBucketNotFound
+		}
+
+		if value = parent.Get(name); value == nil {
+			return ErrKeyNotFound
+		}
+
+		value = CloneBytes(value)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(dstPath) == 0 {
+		dstPath = [][]byte{name}
+	}
+
+	count := 0
+	err = dst.update(func(tx *bolt.Tx) error {
+		if node != nil {
+			return dst.putBucket(tx, dstPath, node, &count)
+		}
+
+		path, key := dstPath[:len(dstPath)-1], dstPath[len(dstPath)-1]
+		if bucketAt(tx, dstPath) != nil {
+			path, key = dstPath, name
+		} else if len(path) == 0 {
+			return ErrBucketNotFound
+		}
+
+		b, err := createBucketAt(tx, path)
+		if err != nil {
+			return err
+		}
+
+		d := *dst
+		d.WithPath(path...)
+		count = 1
+		return d.put(tx, b, []KeyValue{{Key: key, Value: value}})
+	})
+
+	return count, err
+}
+
+// putBucket writes the keys, sequence and nested buckets of n into the bucket of path like Put,
+// adding the number of keys written to count.
+func (c *DB) putBucket(tx *bolt.Tx, path [][]byte, n *BucketNode, count *int) error {
+	b, err := createBucketAt(tx, path)
+	if err != nil {
+		return err
+	}
+
+	d := *c
+	d.WithPath(path...)
+	// the empty buckets are journaled too.
+	d.journalAdd(JournalRecord{Op: OpNewBucket, Path: d.path()})
+	if len(n.Items) > 0 {
+		if err := d.put(tx, b, n.Items); err != nil {
+			return err
+		}
+		*count += len(n.Items)
+	}
+
+	if b.Sequence() != n.Seq {
+		if err := d.setSeq(tx, b, n.Seq); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range n.Buckets {
+		if err := c.putBucket(tx, append(path[:len(path):len(path)], sub.Name), sub, count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package boltcli
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	src, dst := newTestDB(t), newTestDB(t)
+
+	assert.Nil(t, src.WithPath(ParsePath("users/vip")...).Put([]byte("1"), []byte("bingoo")))
+	assert.Nil(t, src.WithPath(ParsePath("users")...).Put([]byte("42"), []byte("huang"), []byte("43"), []byte("hu")))
+	assert.Nil(t, src.SetSeq(43))
+
+	n, err := Copy(dst, ParsePath("users/42"), src, ParsePath("users/42"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	v, err := dst.WithPath(ParsePath("users")...).Get([]byte("42"))
+	assert.Nil(t, err)
+	assert.Equal(t, "huang", string(v))
+
+	n, err = Copy(dst, ParsePath("copied"), src, ParsePath("users"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	seq, err := dst.WithPath(ParsePath("copied")...).Seq()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(43), seq)
+	v, err = dst.WithPath(ParsePath("copied/vip")...).Get([]byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "bingoo", string(v))
+
+	n, err = Copy(src, ParsePath("users/vip"), src, ParsePath("users/43"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	v, err = src.WithPath(ParsePath("users/vip")...).Get([]byte("43"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hu", string(v))
+
+	_, err = Copy(dst, nil, src, ParsePath("users/44"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestCopyRecorded(t *testing.T) {
+	db := newTestDB(t, WithUndo(10))
+
+	assert.Nil(t, db.WithPath(ParsePath("src")...).Put([]byte("k"), []byte("new"), []byte("x"), []byte("1")))
+	dst := *db
+	dst.WithPath(ParsePath("dst")...)
+	assert.Nil(t, dst.Put([]byte("k"), []byte("old"), []byte("y"), []byte("2")))
+	assert.Nil(t, dst.EnableVersions(0))
+
+	// a bucket copied onto an existing bucket is merged into it.
+	n, err := Copy(db, ParsePath("dst"), db, ParsePath("src"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	v, err := dst.Get([]byte("y"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(v))
+
+	versions, err := dst.History([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, "new", string(versions[0].Value))
+	assert.Equal(t, "old", string(versions[1].Value))
+
+	_, err = db.Undo()
+	assert.Nil(t, err)
+	v, err = dst.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "old", string(v))
+	v, err = dst.Get([]byte("x"))
+	assert.Nil(t, err)
+	assert.Empty(t, v)
+}
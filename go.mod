@@ -5,9 +5,12 @@ go 1.16
 require (
 	github.com/c-bata/go-prompt v0.2.6
 	github.com/gin-gonic/gin v1.7.2
+	github.com/klauspost/compress v1.13.6
+	github.com/mattn/go-isatty v0.0.12
 	github.com/seaweedfs/fuse v1.1.8
-	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli/v2 v2.3.0
 	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b
 )
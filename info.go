@@ -0,0 +1,174 @@
+package boltcli
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BucketInfo is the size of a bucket including its nested buckets.
+type BucketInfo struct {
+	Path    string `json:"path"`
+	KeyN    int    `json:"keyN"`
+	BucketN int    `json:"bucketN"`
+	Depth   int    `json:"depth"`
+	Alloc   int    `json:"alloc"`
+	Inuse   int    `json:"inuse"`
+}
+
+// KeyInfo is the size of a value.
+type KeyInfo struct {
+	Path string `json:"path"`
+	Key  string `json:"key"`
+	Size int    `json:"size"`
+}
+
+// Info is the file level information of the db.
+type Info struct {
+	File     string `json:"file"`
+	FileSize int64  `json:"fileSize"`
+	// DataSize is the size of the pages in use up to the high water mark.
+	DataSize int64      `json:"dataSize"`
+	PageSize int        `json:"pageSize"`
+	PageN    int64      `json:"pageN"`
+	TxID     int        `json:"txId"`
+	Stats    bolt.Stats `json:"stats"`
+	// FillFactor is the ratio of the bytes in use to the bytes allocated by all the buckets.
+	FillFactor float64 `json:"fillFactor"`
+	// Buckets are all the buckets in depth first order, TopBuckets and TopKeys the largest ones.
+	Buckets    []BucketInfo `json:"buckets"`
+	TopBuckets []BucketInfo `json:"topBuckets"`
+	TopKeys    []KeyInfo    `json:"topKeys"`
+}
+
+// Info collects the file level information of the db with the top n largest buckets and keys.
+// It reads every value of the db to find the largest keys.
+func (c *DB) Info(n int) (*Info, error) {
+	fi, err := os.Stat(c.DbFile)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{File: c.DbFile, FileSize: fi.Size(), PageSize: c.DB.Info().PageSize, Stats: c.DB.Stats()}
+	keys := &keyHeap{}
+
+	err = c.view(func(tx *bolt.Tx) error {
+		info.TxID, info.DataSize = tx.ID(), tx.Size()
+		info.PageN = info.DataSize / int64(info.PageSize)
+
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return collectBucketInfo(info, keys, n, [][]byte{name}, b)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	alloc, inuse := 0, 0
+	for _, b := range info.Buckets {
+		if b.Depth == 1 {
+			alloc, inuse = alloc+b.Alloc, inuse+b.Inuse
+		}
+	}
+	if alloc > 0 {
+		info.FillFactor = float64(inuse) / float64(alloc)
+	}
+
+	info.TopBuckets = append([]BucketInfo(nil), info.Buckets...)
+	sort.SliceStable(info.TopBuckets, func(i, j int) bool { return info.TopBuckets[i].Alloc > info.TopBuckets[j].Alloc })
+	if len(info.TopBuckets) > n {
+		info.TopBuckets = info.TopBuckets[:n]
+	}
+
+	for keys.Len() > 0 {
+		info.TopKeys = append([]KeyInfo{heap.Pop(keys).(KeyInfo)}, info.TopKeys...)
+	}
+
+	return info, nil
+}
+
+func collectBucketInfo(info *Info, keys *keyHeap, n int, path [][]byte, b *bolt.Bucket) error {
+	s := b.Stats()
+	info.Buckets = append(info.Buckets, BucketInfo{
+		Path: FormatPath(path), KeyN: s.KeyN, BucketN: s.BucketN, Depth: len(path),
+		Alloc: s.BranchAlloc + s.LeafAlloc, Inuse: s.BranchInuse + s.LeafInuse,
+	})
+
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return collectBucketInfo(info, keys, n, append(path[:len(path):len(path)], k), b.Bucket(k))
+		}
+
+		if n > 0 && (keys.Len() < n || len(v) > (*keys)[0].Size) {
+			heap.Push(keys, KeyInfo{Path: FormatPath(path), Key: string(k), Size: len(v)})
+			if keys.Len() > n {
+				heap.Pop(keys)
+			}
+		}
+
+		return nil
+	})
+}
+
+// keyHeap is a min heap of the values by size.
+type keyHeap []KeyInfo
+
+func (h keyHeap) Len() int            { return len(h) }
+func (h keyHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h keyHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keyHeap) Push(x interface{}) { *h = append(*h, x.(KeyInfo)) }
+func (h *keyHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Fprint prints the info as text.
+func (i *Info) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "File            = %s\n", i.File)
+	fmt.Fprintf(w, "FileSize        = %d\t // bytes of the db file\n", i.FileSize)
+	fmt.Fprintf(w, "DataSize        = %d\t // bytes of the pages up to the high water mark\n", i.DataSize)
+	fmt.Fprintf(w, "PageSize        = %d\n", i.PageSize)
+	fmt.Fprintf(w, "PageN           = %d\n", i.PageN)
+	fmt.Fprintf(w, "TxID            = %d\t // id of the last committed transaction\n", i.TxID)
+	fmt.Fprintf(w, "FillFactor      = %.2f\t // bytes in use / bytes allocated by the buckets\n", i.FillFactor)
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Freelist statistics.")
+	fmt.Fprintf(w, "FreePageN       = %d\t // total number of free pages on the freelist\n", i.Stats.FreePageN)
+	fmt.Fprintf(w, "PendingPageN    = %d\t // total number of pending pages on the freelist\n", i.Stats.PendingPageN)
+	fmt.Fprintf(w, "FreeAlloc       = %d\t // total bytes allocated in free pages\n", i.Stats.FreeAlloc)
+	fmt.Fprintf(w, "FreelistInuse   = %d\t // total bytes used by the freelist\n", i.Stats.FreelistInuse)
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Transaction statistics.")
+	fmt.Fprintf(w, "TxN             = %d\t // total number of started read transactions\n", i.Stats.TxN)
+	fmt.Fprintf(w, "OpenTxN         = %d\t // number of currently open read transactions\n", i.Stats.OpenTxN)
+	fmt.Fprintf(w, "PageCount       = %d\t // number of page allocations\n", i.Stats.TxStats.PageCount)
+	fmt.Fprintf(w, "PageAlloc       = %d\t // total bytes allocated\n", i.Stats.TxStats.PageAlloc)
+	fmt.Fprintf(w, "Write           = %d\t // number of writes performed\n", i.Stats.TxStats.Write)
+	fmt.Fprintf(w, "WriteTime       = %s\t // total time spent writing to disk\n", i.Stats.TxStats.WriteTime)
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Buckets (keys, nested buckets, bytes allocated, bytes in use).")
+	for _, b := range i.Buckets {
+		fmt.Fprintf(w, "%-40s %10d %6d %12d %12d\n", b.Path, b.KeyN, b.BucketN-1, b.Alloc, b.Inuse)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Largest buckets (bytes allocated).")
+	for _, b := range i.TopBuckets {
+		fmt.Fprintf(w, "%-40s %12d\n", b.Path, b.Alloc)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Largest keys (value bytes).")
+	for _, k := range i.TopKeys {
+		fmt.Fprintf(w, "%-40s %12d\n", k.Path+PathSeparator+k.Key, k.Size)
+	}
+}
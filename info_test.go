@@ -0,0 +1,25 @@
+package boltcli
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	c := newTestDB(t)
+
+	assert.Nil(t, c.WithPath(ParsePath("a/b")...).Put([]byte("k1"), []byte(strings.Repeat("x", 100))))
+	assert.Nil(t, c.WithPath(ParsePath("a")...).Put([]byte("k2"), []byte("yy"), []byte("k3"), []byte("zzz")))
+	assert.Nil(t, c.WithPath(ParsePath("c")...).Put([]byte("k4"), []byte("v")))
+
+	info, err := c.Info(2)
+	assert.Nil(t, err)
+	assert.True(t, info.FileSize > 0)
+	assert.Equal(t, os.Getpagesize(), info.PageSize)
+	assert.Equal(t, []string{"/a", "/a/b", "/c"}, []string{info.Buckets[0].Path, info.Buckets[1].Path, info.Buckets[2].Path})
+	assert.Equal(t, []KeyInfo{{Path: "/a/b", Key: "k1", Size: 100}, {Path: "/a", Key: "k3", Size: 3}}, info.TopKeys)
+	assert.Equal(t, 2, len(info.TopBuckets))
+	assert.True(t, info.FillFactor > 0 && info.FillFactor <= 1)
+}
@@ -0,0 +1,127 @@
+// Package console pages long outputs and edits values in an external editor
+// for the boltsh and boltcli commands.
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// IsTerminal tells whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// screenLines returns the height of the terminal from $LINES, or 24 by default.
+func screenLines() int {
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 1 {
+		return n
+	}
+
+	return 24
+}
+
+// Page writes the output of fn to stdout. When stdout is a terminal and the output
+// is longer than the screen, it goes through $PAGER, or the built-in pager if unset.
+func Page(fn func(w io.Writer) error) error {
+	if !IsTerminal(os.Stdout) {
+		return fn(os.Stdout)
+	}
+
+	var buf bytes.Buffer
+	err := fn(&buf)
+
+	lines := bytes.Count(buf.Bytes(), []byte("\n"))
+	if lines < screenLines() {
+		_, _ = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	if pager := strings.Fields(os.Getenv("PAGER")); len(pager) > 0 {
+		cmd := exec.Command(pager[0], pager[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = &buf, os.Stdout, os.Stderr
+		if perr := cmd.Run(); perr != nil {
+			fmt.Fprintln(os.Stderr, "pager "+os.Getenv("PAGER")+" err "+perr.Error())
+		}
+		return err
+	}
+
+	builtinPager(&buf, os.Stdout, os.Stdin, screenLines()-1)
+	return err
+}
+
+// builtinPager writes r page by page, waiting for Enter to continue or q to quit.
+func builtinPager(r io.Reader, w io.Writer, in io.Reader, pageLines int) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	answers := bufio.NewReader(in)
+
+	for n := 1; scanner.Scan(); n++ {
+		fmt.Fprintln(w, scanner.Text())
+		if n%pageLines != 0 {
+			continue
+		}
+
+		fmt.Fprint(w, "--More-- (Enter: next page, q: quit)")
+		answer, err := answers.ReadString('\n')
+		if err != nil || strings.TrimSpace(answer) == "q" {
+			fmt.Fprintln(w)
+			return
+		}
+	}
+}
+
+// Edit opens content in $EDITOR (vi by default) and returns the saved content.
+// The suffix, like .json, helps the editor to highlight the syntax.
+func Edit(content []byte, suffix string) ([]byte, error) {
+	f, err := os.CreateTemp("", "bolt-edit-*"+suffix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor %s err %w", editor[0], err)
+	}
+
+	return os.ReadFile(f.Name())
+}
+
+// Confirm asks a yes/no question on the terminal, it fails if stdin is not a terminal.
+func Confirm(question string) (bool, error) {
+	if !IsTerminal(os.Stdin) {
+		return false, fmt.Errorf("%s: no terminal to confirm, use --yes", question)
+	}
+
+	fmt.Print(question + " [y/N] ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
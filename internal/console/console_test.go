@@ -0,0 +1,16 @@
+package console
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinPager(t *testing.T) {
+	var out bytes.Buffer
+	builtinPager(strings.NewReader("1\n2\n3\n4\n5\n"), &out, strings.NewReader("\nq\n"), 2)
+
+	if g, e := out.String(), "1\n2\n--More-- (Enter: next page, q: quit)3\n4\n--More-- (Enter: next page, q: quit)\n"; g != e {
+		t.Errorf("unexpected pager output: %q != %q", g, e)
+	}
+}
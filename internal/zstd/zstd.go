@@ -0,0 +1,29 @@
+// Package zstd adds the zstd compression of the backups for the boltsh and boltcli commands.
+// It is kept out of the library, so the library itself does not depend on the zstd implementation.
+package zstd
+
+import (
+	"io"
+
+	"github.com/bingoohuang/boltcli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Name is the name of the zstd compression.
+const Name = "zstd"
+
+// Register registers the zstd compression to the backups, see boltcli.RegisterCompression.
+func Register() {
+	boltcli.RegisterCompression(boltcli.Compression{
+		Name: Name, Ext: ".zst", Magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return d.IOReadCloser(), nil
+		},
+	})
+}
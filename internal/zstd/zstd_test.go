@@ -0,0 +1,45 @@
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bingoohuang/boltcli"
+)
+
+func TestRegister(t *testing.T) {
+	Register()
+
+	var buf bytes.Buffer
+	w, err := boltcli.NewCompressWriter(&buf, Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := boltcli.DetectCompression(buf.Bytes()); g != Name {
+		t.Errorf("unexpected compression %q", g)
+	}
+	if g := boltcli.CompressionExt(Name); g != ".zst" {
+		t.Errorf("unexpected extension %q", g)
+	}
+
+	r, err := boltcli.NewDecompressReader(&buf, Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("unexpected data %q", data)
+	}
+}
@@ -0,0 +1,465 @@
+package boltcli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The operations recorded only in the journal, the others are shared with the undo log.
+const (
+	OpNewBucket = "bucket.new"
+	// OpPutBucket writes the keys, sequence and nested buckets of Bucket into the bucket of Path.
+	OpPutBucket = "bucket.put"
+)
+
+const (
+	// DefaultJournalSegmentSize is the size a journal segment is rotated at.
+	DefaultJournalSegmentSize = 64 << 20
+	journalSegmentExt         = ".jnl"
+	// journalBrokenFile in the journal dir keeps the TxID of the latest transaction missing from the journal.
+	journalBrokenFile = "BROKEN"
+)
+
+// ErrJournalBroken tells the journal misses a committed transaction after the latest full backup.
+var ErrJournalBroken = errors.New("journal misses a committed transaction, take a full backup")
+
+// JournalDir is the default journal dir of a db file.
+func JournalDir(dbFile string) string { return dbFile + ".journal" }
+
+// WithJournal appends all the writes made through DB to the segmented journal in dir, see JournalRecord.
+// The records are appended after the transaction is committed, so a crash in between loses the
+// last transaction from the journal, and the writes of the processes without the journal are missing.
+func WithJournal(dir string) OptionFn { return func(o *Option) { o.JournalDir = dir } }
+
+// JournalRecord is a write recorded in the journal, one JSON object per line.
+// The records of a transaction share its TxID and commit Time.
+type JournalRecord struct {
+	TxID int       `json:"txId"`
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	// Path is the bucket of the keys, or the bucket itself for the bucket operations.
+	Path [][]byte `json:"path"`
+	// Items are the values put, Keys the keys deleted.
+	Items []KeyValue `json:"items,omitempty"`
+	Keys  [][]byte   `json:"keys,omitempty"`
+	Seq   uint64     `json:"seq,omitempty"`
+	// Bucket is the content written by OpPutBucket.
+	Bucket *BucketNode `json:"bucket,omitempty"`
+}
+
+// journal appends the records of the committed transactions to the segments named by their first txid.
+// Its lock is taken before the bolt writer lock, so the records are in the commit order.
+type journal struct {
+	mu          sync.Mutex
+	dir         string
+	segmentSize int64
+	f           *os.File
+	size        int64
+	pending     []JournalRecord
+}
+
+func openJournal(dir string, segmentSize int64) (*journal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	j := &journal{dir: dir, segmentSize: segmentSize}
+	segments, err := journalSegments(dir)
+	if err != nil || len(segments) == 0 {
+		return j, err
+	}
+
+	last := segments[len(segments)-1]
+	if j.f, err = os.OpenFile(last.path, os.O_RDWR, 0600); err != nil {
+		return nil, err
+	}
+
+	// a crash in the middle of an append leaves a partial last line.
+	if j.size, err = truncateTornLine(j.f); err != nil {
+		j.f.Close()
+		return nil, err
+	}
+
+	if _, err = j.f.Seek(j.size, io.SeekStart); err != nil {
+		j.f.Close()
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// truncateTornLine truncates the file after its last newline and returns the new size.
+func truncateTornLine(f *os.File) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 4096)
+	for end := fi.Size(); end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			size := start + int64(i) + 1
+			if size == fi.Size() {
+				return size, nil
+			}
+			return size, f.Truncate(size)
+		}
+
+		end = start
+	}
+
+	return 0, f.Truncate(0)
+}
+
+func (j *journal) close() error {
+	if j.f == nil {
+		return nil
+	}
+
+	return j.f.Close()
+}
+
+// update runs fn in a new bolt transaction and appends its records after it is committed.
+func (j *journal) update(db *bolt.DB, fn func(tx *bolt.Tx) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.pending = j.pending[:0]
+	txID := 0
+	err := db.Update(func(tx *bolt.Tx) error {
+		txID = tx.ID()
+		return fn(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	j.flushCommitted(txID)
+	return nil
+}
+
+// commit commits the explicit transaction begun with the journal locked and appends its records.
+func (j *journal) commit(tx *bolt.Tx) error {
+	defer j.mu.Unlock()
+
+	txID := tx.ID()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	j.flushCommitted(txID)
+	return nil
+}
+
+// flushCommitted appends the records of the committed transaction. The transaction stays committed
+// when they fail to append, so the journal is marked broken instead, see JournalBroken.
+func (j *journal) flushCommitted(txID int) {
+	err := j.flush(txID)
+	if err == nil {
+		return
+	}
+
+	log.Printf("WARN: journal %s misses the committed tx %d: %v", j.dir, txID, err)
+	j.pending = j.pending[:0]
+	// the next records go to a new segment, after the partial line left by a failed write.
+	if j.f != nil {
+		j.f.Close()
+		j.f = nil
+	}
+
+	data := []byte(strconv.Itoa(txID))
+	if err := os.WriteFile(filepath.Join(j.dir, journalBrokenFile), data, 0600); err != nil {
+		log.Printf("WARN: mark journal %s broken: %v", j.dir, err)
+	}
+}
+
+// JournalBroken returns the TxID of the latest committed transaction missing from the journal dir, 0 for none.
+// The incremental backups refuse to run until a full backup is taken after it.
+func JournalBroken(dir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, journalBrokenFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func (j *journal) add(r JournalRecord) { j.pending = append(j.pending, r) }
+
+func (j *journal) flush(txID int) error {
+	if len(j.pending) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	now := time.Now()
+	for _, r := range j.pending {
+		r.TxID, r.Time = txID, now
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	j.pending = j.pending[:0]
+
+	if j.f == nil {
+		name := filepath.Join(j.dir, fmt.Sprintf("%020d%s", txID, journalSegmentExt))
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		j.f, j.size = f, 0
+	}
+
+	n, err := j.f.Write(buf.Bytes())
+	if j.size += int64(n); err != nil {
+		return err
+	}
+
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+
+	if j.size >= j.segmentSize {
+		f := j.f
+		j.f = nil
+		return f.Close()
+	}
+
+	return nil
+}
+
+// journalAdd records a write of the current transaction when the journal is enabled.
+func (c *DB) journalAdd(r JournalRecord) {
+	if c.journal != nil {
+		c.journal.add(r)
+	}
+}
+
+type journalSegment struct {
+	firstTxID int
+	path      string
+}
+
+func journalSegments(dir string) ([]journalSegment, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+journalSegmentExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []journalSegment
+	for _, file := range files {
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(file), journalSegmentExt))
+		if err == nil {
+			segments = append(segments, journalSegment{firstTxID: id, path: file})
+		}
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].firstTxID < segments[j].firstTxID })
+	return segments, nil
+}
+
+// ReadJournal reads the records of the journal dir with a TxID after the given one.
+func ReadJournal(dir string, after int, f func(JournalRecord) error) error {
+	segments, err := journalSegments(dir)
+	if err != nil {
+		return err
+	}
+
+	for i, s := range segments {
+		// all the records of the segment are before the first one of the next segment.
+		if i+1 < len(segments) && segments[i+1].firstTxID <= after+1 {
+			continue
+		}
+
+		if err := readJournalFile(s.path, after, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readJournalFile(file string, after int, f func(JournalRecord) error) error {
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return ReadJournalRecords(r, func(rec JournalRecord) error {
+		if rec.TxID <= after {
+			return nil
+		}
+		return f(rec)
+	})
+}
+
+// ReadJournalRecords reads the JSON lines of journal records, a partial last line is ignored.
+func ReadJournalRecords(r io.Reader, f func(JournalRecord) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return nil // a line without the newline is a torn write
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec JournalRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("journal record: %w", err)
+		}
+
+		if err := f(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// PruneJournal removes the journal segments whose records all have a TxID up to the given one,
+// the last segment is kept since it may be appended to.
+func PruneJournal(dir string, upTo int) ([]string, error) {
+	segments, err := journalSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for i := 0; i+1 < len(segments) && segments[i+1].firstTxID <= upTo+1; i++ {
+		if err := os.Remove(segments[i].path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, segments[i].path)
+	}
+
+	return removed, nil
+}
+
+// apply replays the record in tx.
+func (r *JournalRecord) apply(tx *bolt.Tx) error {
+	switch r.Op {
+	case OpDelBucket:
+		if len(r.Path) == 1 {
+			return tx.DeleteBucket(r.Path[0])
+		}
+		parent := bucketAt(tx, r.Path[:len(r.Path)-1])
+		if parent == nil {
+			return ErrBucketNotFound
+		}
+		return parent.DeleteBucket(r.Path[len(r.Path)-1])
+	case OpDel:
+		b := bucketAt(tx, r.Path)
+		if b == nil {
+			return ErrBucketNotFound
+		}
+		for _, k := range r.Keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	b, err := createBucketAt(tx, r.Path)
+	if err != nil {
+		return err
+	}
+
+	switch r.Op {
+	case OpNewBucket:
+		return nil
+	case OpPut:
+		for _, item := range r.Items {
+			if err := b.Put(item.Key, item.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OpSetSeq:
+		return b.SetSequence(r.Seq)
+	case OpPutBucket:
+		if r.Bucket == nil {
+			return fmt.Errorf("journal tx %d: no bucket recorded", r.TxID)
+		}
+		_, err := r.Bucket.writeTo(b)
+		return err
+	default:
+		return fmt.Errorf("journal tx %d: unknown op %s", r.TxID, r.Op)
+	}
+}
+
+// Replay applies the journal records to db, the records of a transaction in one transaction.
+// It stops before the first transaction committed after until when until is not zero.
+func Replay(db *bolt.DB, r io.Reader, until time.Time) (int, error) {
+	var batch []JournalRecord
+	txN := 0
+	apply := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := db.Update(func(tx *bolt.Tx) error {
+			for i := range batch {
+				if err := batch[i].apply(tx); err != nil {
+					return fmt.Errorf("replay %s of tx %d: %w", batch[i].Op, batch[i].TxID, err)
+				}
+			}
+			return nil
+		})
+		batch = batch[:0]
+		txN++
+		return err
+	}
+
+	errUntil := errors.New("until")
+	err := ReadJournalRecords(r, func(rec JournalRecord) error {
+		if !until.IsZero() && rec.Time.After(until) {
+			return errUntil
+		}
+
+		if len(batch) > 0 && batch[0].TxID != rec.TxID {
+			if err := apply(); err != nil {
+				return err
+			}
+		}
+
+		batch = append(batch, rec)
+		return nil
+	})
+	if err != nil && err != errUntil {
+		return txN, err
+	}
+
+	return txN, apply()
+}
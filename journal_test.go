@@ -0,0 +1,187 @@
+package boltcli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// dumpFile reads all the visible buckets of the db file.
+func dumpFile(t *testing.T, file string) []*BucketNode {
+	db, err := bolt.Open(file, 0600, &bolt.Options{ReadOnly: true})
+	assert.Nil(t, err)
+	defer db.Close()
+
+	return dumpBuckets(t, db)
+}
+
+func dumpBuckets(t *testing.T, db *bolt.DB) []*BucketNode {
+	var nodes []*BucketNode
+	assert.Nil(t, db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if !IsHiddenBucket(name) {
+				nodes = append(nodes, readBucketNode(name, b))
+			}
+			return nil
+		})
+	}))
+
+	return nodes
+}
+
+func TestJournalReplay(t *testing.T) {
+	journalDir := filepath.Join(t.TempDir(), "journal")
+	c := newTestDB(t, WithUndo(10), WithJournal(journalDir), func(o *Option) { o.JournalSegmentSize = 200 })
+
+	assert.Nil(t, c.Put([]byte("k1"), []byte("v1"), []byte("k2"), []byte("v2")))
+	assert.Nil(t, c.Del([]byte("k1")))
+	assert.Nil(t, c.NewBucket([]byte("a"), []byte("b")))
+	assert.Nil(t, c.WithPath(ParsePath("a/b")...).SetSeq(7))
+	_, err := c.WithPath(ParsePath("a/b")...).NextSeq()
+	assert.Nil(t, err)
+	assert.Nil(t, c.WithPath(ParsePath("default")...).CompareAndPut([]byte("k2"), []byte("v2"), []byte("v3")))
+
+	assert.Nil(t, c.Begin())
+	assert.Nil(t, c.Put([]byte("rolled"), []byte("back")))
+	_, err = c.Rollback()
+	assert.Nil(t, err)
+
+	assert.Nil(t, c.Begin())
+	assert.Nil(t, c.Put([]byte("k4"), []byte("v4")))
+	_, err = c.Commit()
+	assert.Nil(t, err)
+
+	_, err = Copy(c, ParsePath("c"), c, ParsePath("a"))
+	assert.Nil(t, err)
+	assert.Nil(t, c.DelBucket([]byte("a")))
+	_, err = c.Undo()
+	assert.Nil(t, err)
+
+	var ops []string
+	assert.Nil(t, ReadJournal(journalDir, 0, func(r JournalRecord) error {
+		ops = append(ops, r.Op)
+		return nil
+	}))
+	assert.Equal(t, []string{OpPut, OpDel, OpNewBucket, OpSetSeq, OpSetSeq, OpPut, OpPut,
+		OpNewBucket, OpNewBucket, OpSetSeq, OpDelBucket, OpNewBucket, OpPutBucket}, ops)
+
+	segments, err := journalSegments(journalDir)
+	assert.Nil(t, err)
+	assert.True(t, len(segments) > 1)
+
+	// replaying the journal onto an empty db gives the same db.
+	replayed := filepath.Join(t.TempDir(), "replayed.bolt")
+	db, err := bolt.Open(replayed, 0600, nil)
+	assert.Nil(t, err)
+	for _, s := range segments {
+		f, err := os.Open(s.path)
+		assert.Nil(t, err)
+		_, err = Replay(db, f, time.Time{})
+		assert.Nil(t, err)
+		f.Close()
+	}
+	assert.Nil(t, db.Close())
+	assert.Equal(t, dumpBuckets(t, c.DB), dumpFile(t, replayed))
+}
+
+func TestJournalTornLine(t *testing.T) {
+	journalDir := filepath.Join(t.TempDir(), "journal")
+	file := filepath.Join(t.TempDir(), "test.bolt")
+
+	c, err := New(file, WithJournal(journalDir))
+	assert.Nil(t, err)
+	assert.Nil(t, c.Put([]byte("k1"), []byte("v1")))
+	assert.Nil(t, c.Close())
+
+	segments, _ := journalSegments(journalDir)
+	f, err := os.OpenFile(segments[0].path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, _ = f.WriteString(`{"txId":99,"op":"pu`)
+	assert.Nil(t, f.Close())
+
+	c, err = New(file, WithJournal(journalDir))
+	assert.Nil(t, err)
+	assert.Nil(t, c.Put([]byte("k2"), []byte("v2")))
+	assert.Nil(t, c.Close())
+
+	var keys []string
+	assert.Nil(t, ReadJournal(journalDir, 0, func(r JournalRecord) error {
+		keys = append(keys, string(r.Items[0].Key))
+		return nil
+	}))
+	assert.Equal(t, []string{"k1", "k2"}, keys)
+}
+
+func TestBackupIncremental(t *testing.T) {
+	journalDir := filepath.Join(t.TempDir(), "journal")
+	c := newTestDB(t, WithJournal(journalDir))
+	dir := t.TempDir()
+
+	assert.Nil(t, c.Put([]byte("k1"), []byte("v1")))
+	base, err := c.BackupFile(dir, CompressGzip)
+	assert.Nil(t, err)
+
+	_, err = BackupIncremental(dir, c.DbFile, journalDir, CompressGzip)
+	assert.Equal(t, ErrNoChanges, err)
+
+	assert.Nil(t, c.Put([]byte("k2"), []byte("v2")))
+	inc1, err := BackupIncremental(dir, c.DbFile, journalDir, CompressGzip)
+	assert.Nil(t, err)
+	assert.Equal(t, base.File, inc1.Base)
+
+	until := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, c.Del([]byte("k1")))
+	assert.Nil(t, c.Put([]byte("k3"), []byte("v3")))
+	inc2, err := BackupIncremental(dir, c.DbFile, journalDir, CompressNone)
+	assert.Nil(t, err)
+	assert.True(t, inc2.TxID > inc1.TxID)
+
+	target := filepath.Join(t.TempDir(), "target.bolt")
+	assert.Nil(t, Restore(filepath.Join(dir, base.File), target, RestoreOption{Increments: true}))
+	assert.Equal(t, dumpBuckets(t, c.DB), dumpFile(t, target))
+
+	assert.Nil(t, Restore(filepath.Join(dir, base.File), target, RestoreOption{Increments: true, Until: until}))
+	assert.Equal(t, []KeyValue{{Key: []byte("k1"), Value: []byte("v1")}, {Key: []byte("k2"), Value: []byte("v2")}},
+		dumpFile(t, target)[0].Items)
+
+	removed, err := PruneJournal(journalDir, inc2.TxID)
+	assert.Nil(t, err)
+	assert.Empty(t, removed) // the only segment is the last one
+}
+
+func TestJournalBroken(t *testing.T) {
+	journalDir := filepath.Join(t.TempDir(), "journal")
+	c := newTestDB(t, WithJournal(journalDir))
+	dir := t.TempDir()
+
+	assert.Nil(t, c.Put([]byte("k1"), []byte("v1")))
+	_, err := c.BackupFile(dir, CompressNone)
+	assert.Nil(t, err)
+
+	// the records of the committed put fail to append.
+	assert.Nil(t, c.journal.f.Close())
+	assert.Nil(t, c.Put([]byte("k2"), []byte("v2")))
+	v, err := c.Get([]byte("k2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(v))
+
+	lost, err := JournalBroken(journalDir)
+	assert.Nil(t, err)
+	assert.True(t, lost > 0)
+
+	assert.Nil(t, c.Put([]byte("k3"), []byte("v3")))
+	_, err = BackupIncremental(dir, c.DbFile, journalDir, CompressNone)
+	assert.Equal(t, ErrJournalBroken, err)
+
+	// a full backup after the missing transaction holds it.
+	_, err = c.BackupFile(dir, CompressNone)
+	assert.Nil(t, err)
+	assert.Nil(t, c.Put([]byte("k4"), []byte("v4")))
+	_, err = BackupIncremental(dir, c.DbFile, journalDir, CompressNone)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,231 @@
+package boltcli
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// PromContentType is the content type of the Prometheus text exposition format.
+const PromContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PromWriter writes metrics in the Prometheus text exposition format. The samples of a metric family
+// follow its Family line, the first error is kept by Err.
+type PromWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewPromWriter returns a writer of the metrics to w, call Flush at the end.
+func NewPromWriter(w io.Writer) *PromWriter {
+	return &PromWriter{w: bufio.NewWriter(w)}
+}
+
+// Family starts the metric family of the name with its type like counter, gauge or histogram.
+func (p *PromWriter) Family(name, typ, help string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	p.write("# HELP " + name + " " + help + "\n# TYPE " + name + " " + typ + "\n")
+}
+
+// Sample writes a sample of the metric with the label names and values in pairs.
+func (p *PromWriter) Sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 1 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+		}
+		b.WriteByte('}')
+	}
+
+	b.WriteString(" " + formatFloat(value) + "\n")
+	p.write(b.String())
+}
+
+// Histogram writes the samples of a histogram with the upper bounds and the counts of the observations
+// in each bucket, not cumulated.
+func (p *PromWriter) Histogram(name string, bounds []float64, counts []uint64, sum float64, labels ...string) {
+	var total uint64
+	for i, bound := range bounds {
+		total += counts[i]
+		p.Sample(name+"_bucket", float64(total), append(labels[:len(labels):len(labels)], "le", formatFloat(bound))...)
+	}
+	if len(counts) > len(bounds) {
+		total += counts[len(bounds)]
+	}
+
+	p.Sample(name+"_bucket", float64(total), append(labels[:len(labels):len(labels)], "le", "+Inf")...)
+	p.Sample(name+"_sum", sum, labels...)
+	p.Sample(name+"_count", float64(total), labels...)
+}
+
+// Flush writes the buffered metrics and returns the first error.
+func (p *PromWriter) Flush() error {
+	if p.err == nil {
+		p.err = p.w.Flush()
+	}
+
+	return p.err
+}
+
+// Err returns the first error.
+func (p *PromWriter) Err() error { return p.err }
+
+func (p *PromWriter) write(s string) {
+	if p.err == nil {
+		_, p.err = p.w.WriteString(s)
+	}
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Metrics exports the statistics of the db in the Prometheus text format, see Write and ServeHTTP.
+type Metrics struct {
+	DB *DB
+	// BucketDepth is the depth of the buckets whose keys are counted, 0 to not count them.
+	BucketDepth int
+	// BucketInterval is the time the key counts are reused for, they walk all the pages of the buckets.
+	BucketInterval time.Duration
+
+	mu      sync.Mutex
+	sampled time.Time
+	buckets []bucketKeys
+}
+
+type bucketKeys struct {
+	path string
+	keyN int
+}
+
+// NewMetrics returns the metrics of the db counting the keys of the top level buckets every minute.
+func NewMetrics(db *DB) *Metrics {
+	return &Metrics{DB: db, BucketDepth: 1, BucketInterval: time.Minute}
+}
+
+// ServeHTTP serves the metrics, as a /metrics handler.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", PromContentType)
+	p := NewPromWriter(w)
+	m.Write(p)
+	_ = p.Flush()
+}
+
+// Write writes the metrics of the db file, of its transactions and the key counts of its buckets.
+func (m *Metrics) Write(p *PromWriter) {
+	s := m.DB.DB.Stats()
+	if fi, err := os.Stat(m.DB.DbFile); err == nil {
+		gauge(p, "bolt_file_size_bytes", "Size of the db file.", float64(fi.Size()))
+	}
+
+	gauge(p, "bolt_freelist_free_pages", "Number of free pages on the freelist.", float64(s.FreePageN))
+	gauge(p, "bolt_freelist_pending_pages", "Number of pending pages on the freelist.", float64(s.PendingPageN))
+	gauge(p, "bolt_freelist_free_bytes", "Bytes allocated in free pages.", float64(s.FreeAlloc))
+	gauge(p, "bolt_freelist_inuse_bytes", "Bytes used by the freelist.", float64(s.FreelistInuse))
+	counter(p, "bolt_read_tx_total", "Number of started read transactions.", float64(s.TxN))
+	gauge(p, "bolt_open_read_tx", "Number of open read transactions.", float64(s.OpenTxN))
+
+	t := s.TxStats
+	counter(p, "bolt_tx_page_allocations_total", "Number of page allocations.", float64(t.PageCount))
+	counter(p, "bolt_tx_page_alloc_bytes_total", "Bytes allocated by the pages.", float64(t.PageAlloc))
+	counter(p, "bolt_tx_cursors_total", "Number of cursors created.", float64(t.CursorCount))
+	counter(p, "bolt_tx_node_allocations_total", "Number of node allocations.", float64(t.NodeCount))
+	counter(p, "bolt_tx_rebalances_total", "Number of node rebalances.", float64(t.Rebalance))
+	counter(p, "bolt_tx_rebalance_seconds_total", "Time spent rebalancing.", t.RebalanceTime.Seconds())
+	counter(p, "bolt_tx_splits_total", "Number of nodes split.", float64(t.Split))
+	counter(p, "bolt_tx_spills_total", "Number of nodes spilled.", float64(t.Spill))
+	counter(p, "bolt_tx_spill_seconds_total", "Time spent spilling.", t.SpillTime.Seconds())
+	counter(p, "bolt_tx_writes_total", "Number of writes to the disk.", float64(t.Write))
+	counter(p, "bolt_tx_write_seconds_total", "Time spent writing to the disk.", t.WriteTime.Seconds())
+
+	if m.BucketDepth <= 0 {
+		return
+	}
+
+	buckets, err := m.bucketKeys()
+	if err != nil {
+		return
+	}
+
+	p.Family("bolt_bucket_keys", "gauge", "Number of keys of the bucket including its nested buckets, sampled.")
+	for _, b := range buckets {
+		p.Sample("bolt_bucket_keys", float64(b.keyN), "bucket", b.path)
+	}
+}
+
+// bucketKeys returns the key counts of the buckets sampled within BucketInterval, or samples them now.
+func (m *Metrics) bucketKeys() ([]bucketKeys, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.buckets != nil && time.Since(m.sampled) < m.BucketInterval {
+		return m.buckets, nil
+	}
+
+	buckets := []bucketKeys{}
+	var walk func(path [][]byte, b *bolt.Bucket) error
+	walk = func(path [][]byte, b *bolt.Bucket) error {
+		buckets = append(buckets, bucketKeys{path: FormatPath(path), keyN: b.Stats().KeyN})
+		if len(path) >= m.BucketDepth {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			return walk(append(path[:len(path):len(path)], k), b.Bucket(k))
+		})
+	}
+
+	err := m.DB.view(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if IsHiddenBucket(name) {
+				return nil
+			}
+			return walk([][]byte{name}, b)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.buckets, m.sampled = buckets, time.Now()
+	return buckets, nil
+}
+
+func gauge(p *PromWriter, name, help string, value float64) {
+	p.Family(name, "gauge", help)
+	p.Sample(name, value)
+}
+
+func counter(p *PromWriter, name, help string, value float64) {
+	p.Family(name, "counter", help)
+	p.Sample(name, value)
+}
@@ -0,0 +1,71 @@
+package boltcli
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromWriter(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPromWriter(&buf)
+	p.Family("x_total", "counter", "Help with \\ and\nnew line.")
+	p.Sample("x_total", 1.5, "a", `q"\`+"\n", "b", "2")
+	p.Sample("x_total", 3)
+	p.Family("d_seconds", "histogram", "Durations.")
+	p.Histogram("d_seconds", []float64{0.1, 1}, []uint64{2, 1, 4}, 9.25, "route", "/r")
+	assert.Nil(t, p.Flush())
+
+	assert.Equal(t, `# HELP x_total Help with \\ and\nnew line.
+# TYPE x_total counter
+x_total{a="q\"\\\n",b="2"} 1.5
+x_total 3
+# HELP d_seconds Durations.
+# TYPE d_seconds histogram
+d_seconds_bucket{route="/r",le="0.1"} 2
+d_seconds_bucket{route="/r",le="1"} 3
+d_seconds_bucket{route="/r",le="+Inf"} 7
+d_seconds_sum{route="/r"} 9.25
+d_seconds_count{route="/r"} 7
+`, buf.String())
+}
+
+func TestMetrics(t *testing.T) {
+	c := newTestDB(t)
+	assert.Nil(t, c.WithPath(ParsePath("a/b")...).Put([]byte("k1"), []byte("v")))
+	assert.Nil(t, c.WithPath(ParsePath("c")...).Put([]byte("k2"), []byte("v")))
+
+	m := NewMetrics(c)
+	m.BucketDepth = 2
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, PromContentType, w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE bolt_file_size_bytes gauge\nbolt_file_size_bytes ")
+	assert.Contains(t, body, "# TYPE bolt_tx_writes_total counter\n")
+	assert.Contains(t, body, `bolt_bucket_keys{bucket="/a"} 2`+"\n"+`bolt_bucket_keys{bucket="/a/b"} 1`+"\n"+`bolt_bucket_keys{bucket="/c"} 1`)
+
+	// the key counts are sampled once per BucketInterval.
+	assert.Nil(t, c.WithPath(ParsePath("c")...).Put([]byte("k3"), []byte("v")))
+	var buf bytes.Buffer
+	p := NewPromWriter(&buf)
+	m.Write(p)
+	assert.Nil(t, p.Flush())
+	assert.Contains(t, buf.String(), `bolt_bucket_keys{bucket="/c"} 1`)
+
+	m.BucketInterval = time.Nanosecond
+	buf.Reset()
+	m.Write(p)
+	assert.Nil(t, p.Flush())
+	assert.Contains(t, buf.String(), `bolt_bucket_keys{bucket="/c"} 2`)
+
+	m.BucketDepth = 0
+	buf.Reset()
+	m.Write(p)
+	assert.Nil(t, p.Flush())
+	assert.False(t, strings.Contains(buf.String(), "bolt_bucket_keys"))
+}
@@ -0,0 +1,466 @@
+package boltcli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+)
+
+// The page level layout of the bolt file format, which is in the native byte order
+// of the machine that wrote it, little endian is assumed here.
+const (
+	pageHeaderSize   = 16
+	pageElementSize  = 16
+	bucketHeaderSize = 16
+	metaSize         = 64
+	boltMagic        = 0xED0CDAED
+
+	branchPageFlag   = 0x01
+	leafPageFlag     = 0x02
+	metaPageFlag     = 0x04
+	freelistPageFlag = 0x10
+	bucketLeafFlag   = 0x01
+
+	// maxPageSize bounds the page size read from a meta page, the pages are allocated by it.
+	maxPageSize = 1 << 20
+)
+
+// The page types told by PageFile.
+const (
+	PageBranch   = "branch"
+	PageLeaf     = "leaf"
+	PageMeta     = "meta"
+	PageFreelist = "freelist"
+	PageFree     = "free"
+)
+
+var ErrInvalidFile = errors.New("invalid bolt file")
+
+// Meta is the meta page of a bolt file.
+type Meta struct {
+	Version  uint32 `json:"version"`
+	PageSize uint32 `json:"pageSize"`
+	Flags    uint32 `json:"flags"`
+	Root     uint64 `json:"root"`
+	Freelist uint64 `json:"freelist"`
+	// PageN is the high water mark of the page ids.
+	PageN uint64 `json:"pageN"`
+	TxID  uint64 `json:"txId"`
+}
+
+// PageInfo describes a page and its overflow pages.
+type PageInfo struct {
+	ID       uint64 `json:"id"`
+	Type     string `json:"type"`
+	Count    int    `json:"count"`
+	Overflow int    `json:"overflow"`
+	// Used is the number of bytes in use, Size the allocated bytes including the overflow pages.
+	Used int `json:"used"`
+	Size int `json:"size"`
+}
+
+// Utilization is the ratio of the used bytes to the allocated bytes.
+func (p PageInfo) Utilization() float64 { return float64(p.Used) / float64(p.Size) }
+
+// PageElem is an element of a branch or a leaf page.
+type PageElem struct {
+	Key []byte `json:"key"`
+	// Child is the child page of a branch element.
+	Child uint64 `json:"child,omitempty"`
+	// Value is the value of a leaf element, a bucket header when Bucket is true.
+	Value  []byte `json:"value,omitempty"`
+	Bucket bool   `json:"bucket,omitempty"`
+}
+
+// PageFile reads the pages of a bolt file directly, without the file lock,
+// so it works while another process has the db opened. The pages may change
+// under a concurrent writer, so the result is a best effort snapshot.
+type PageFile struct {
+	f        *os.File
+	PageSize int
+	Meta     Meta
+}
+
+// OpenPageFile opens a bolt file read only and loads its latest valid meta page.
+func OpenPageFile(path string) (*PageFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PageFile{f: f}
+	if err := p.loadMeta(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *PageFile) Close() error { return p.f.Close() }
+
+func (p *PageFile) loadMeta() error {
+	buf := make([]byte, pageHeaderSize+metaSize)
+	if _, err := p.f.ReadAt(buf, 0); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	m0, ok0 := parseMeta(buf[pageHeaderSize:])
+	if !ok0 && m0.PageSize == 0 {
+		return ErrInvalidFile
+	}
+
+	// the second meta page follows the first one, its offset depends on the page size.
+	if _, err := p.f.ReadAt(buf, int64(m0.PageSize)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	m1, ok1 := parseMeta(buf[pageHeaderSize:])
+	switch {
+	case ok0 && (!ok1 || m0.TxID >= m1.TxID):
+		p.Meta = m0
+	case ok1:
+		p.Meta = m1
+	default:
+		return ErrInvalidFile
+	}
+
+	if p.Meta.PageSize < pageHeaderSize+metaSize || p.Meta.PageSize > maxPageSize {
+		return fmt.Errorf("%w: page size %d", ErrInvalidFile, p.Meta.PageSize)
+	}
+
+	p.PageSize = int(p.Meta.PageSize)
+	return nil
+}
+
+func parseMeta(b []byte) (Meta, bool) {
+	le := binary.LittleEndian
+	m := Meta{
+		Version: le.Uint32(b[4:]), PageSize: le.Uint32(b[8:]), Flags: le.Uint32(b[12:]),
+		Root: le.Uint64(b[16:]), Freelist: le.Uint64(b[32:]), PageN: le.Uint64(b[40:]), TxID: le.Uint64(b[48:]),
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write(b[:56])
+	ok := le.Uint32(b) == boltMagic && m.Version == 2 && le.Uint64(b[56:]) == h.Sum64()
+	return m, ok
+}
+
+// readPage reads page id with its overflow pages.
+func (p *PageFile) readPage(id uint64) ([]byte, error) {
+	if id >= p.Meta.PageN {
+		return nil, fmt.Errorf("page %d is beyond the high water mark %d", id, p.Meta.PageN)
+	}
+
+	buf := make([]byte, p.PageSize)
+	if _, err := p.f.ReadAt(buf, int64(id)*int64(p.PageSize)); err != nil {
+		return nil, err
+	}
+
+	if overflow := binary.LittleEndian.Uint32(buf[12:]); overflow > 0 {
+		// a torn or corrupt page may tell any overflow, the file holds them all.
+		end := id + 1 + uint64(overflow)
+		fi, err := p.f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if end > p.Meta.PageN || end > uint64(fi.Size())/uint64(p.PageSize) {
+			return nil, fmt.Errorf("%w: page %d overflows %d pages beyond the file", ErrInvalidFile, id, overflow)
+		}
+
+		buf = make([]byte, (1+int(overflow))*p.PageSize)
+		if _, err := p.f.ReadAt(buf, int64(id)*int64(p.PageSize)); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf, nil
+}
+
+// parsePage parses a page, or an inline page of a bucket value. The page is checked to hold
+// its elements, a torn or corrupt page returns ErrInvalidFile.
+func parsePage(buf []byte) (PageInfo, []PageElem, error) {
+	if len(buf) < pageHeaderSize {
+		return PageInfo{}, nil, fmt.Errorf("%w: page of %d bytes", ErrInvalidFile, len(buf))
+	}
+
+	le := binary.LittleEndian
+	flags, count := le.Uint16(buf[8:]), int(le.Uint16(buf[10:]))
+	info := PageInfo{ID: le.Uint64(buf), Count: count, Overflow: int(le.Uint32(buf[12:])), Size: len(buf)}
+	info.Used = pageHeaderSize
+
+	var elems []PageElem
+	switch {
+	case flags&branchPageFlag != 0:
+		info.Type = PageBranch
+		for i := 0; i < count; i++ {
+			off := pageHeaderSize + i*pageElementSize
+			if off+pageElementSize > len(buf) {
+				return info, elems, ErrInvalidFile
+			}
+			pos, ksize := int(le.Uint32(buf[off:])), int(le.Uint32(buf[off+4:]))
+			if !within(buf, off, pos, ksize) {
+				return info, elems, ErrInvalidFile
+			}
+			elems = append(elems, PageElem{Key: buf[off+pos : off+pos+ksize], Child: le.Uint64(buf[off+8:])})
+			info.Used += pageElementSize + ksize
+		}
+	case flags&leafPageFlag != 0:
+		info.Type = PageLeaf
+		for i := 0; i < count; i++ {
+			off := pageHeaderSize + i*pageElementSize
+			if off+pageElementSize > len(buf) {
+				return info, elems, ErrInvalidFile
+			}
+			eflags, pos := le.Uint32(buf[off:]), int(le.Uint32(buf[off+4:]))
+			ksize, vsize := int(le.Uint32(buf[off+8:])), int(le.Uint32(buf[off+12:]))
+			if !within(buf, off, pos, ksize, vsize) {
+				return info, elems, ErrInvalidFile
+			}
+			elems = append(elems, PageElem{
+				Key:    buf[off+pos : off+pos+ksize],
+				Value:  buf[off+pos+ksize : off+pos+ksize+vsize],
+				Bucket: eflags&bucketLeafFlag != 0,
+			})
+			info.Used += pageElementSize + ksize + vsize
+		}
+	case flags&metaPageFlag != 0:
+		info.Type, info.Used = PageMeta, pageHeaderSize+metaSize
+	case flags&freelistPageFlag != 0:
+		info.Type = PageFreelist
+		ids := freelistIDs(buf)
+		info.Used += 8 * len(ids)
+		if count == 0xFFFF {
+			info.Used += 8
+		}
+	default:
+		info.Type = fmt.Sprintf("unknown<%02x>", flags)
+	}
+
+	return info, elems, nil
+}
+
+// within tells whether the sizes from the offset off+pos fit in buf, computed in 64 bits not to overflow.
+func within(buf []byte, off, pos int, sizes ...int) bool {
+	end := int64(off) + int64(pos)
+	for _, size := range sizes {
+		end += int64(size)
+	}
+
+	return end <= int64(len(buf))
+}
+
+// freelistIDs reads the ids of a freelist page, up to the ones the page holds.
+func freelistIDs(buf []byte) []uint64 {
+	if len(buf) < pageHeaderSize {
+		return nil
+	}
+
+	le := binary.LittleEndian
+	count, off := uint64(le.Uint16(buf[10:])), pageHeaderSize
+	if count == 0xFFFF {
+		if len(buf) < off+8 {
+			return nil
+		}
+		count, off = le.Uint64(buf[off:]), off+8
+	}
+
+	if n := uint64(len(buf)-off) / 8; count > n {
+		count = n
+	}
+
+	ids := make([]uint64, 0, count)
+	for i := 0; i < int(count); i++ {
+		ids = append(ids, le.Uint64(buf[off+8*i:]))
+	}
+
+	return ids
+}
+
+// Page reads page id and its elements.
+func (p *PageFile) Page(id uint64) (PageInfo, []PageElem, error) {
+	buf, err := p.readPage(id)
+	if err != nil {
+		return PageInfo{}, nil, err
+	}
+
+	return parsePage(buf)
+}
+
+// Freelist returns the ids of the free pages recorded by the meta page.
+// The pages pending to be freed by the open transactions are not on the disk.
+func (p *PageFile) Freelist() ([]uint64, error) {
+	if p.Meta.Freelist >= p.Meta.PageN {
+		return nil, nil // the freelist is not synced to the disk
+	}
+
+	buf, err := p.readPage(p.Meta.Freelist)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := freelistIDs(buf)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// Pages returns all the pages up to the high water mark, the pages on the freelist are typed PageFree.
+func (p *PageFile) Pages() ([]PageInfo, error) {
+	ids, err := p.Freelist()
+	if err != nil {
+		return nil, err
+	}
+
+	free := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		free[id] = true
+	}
+
+	var pages []PageInfo
+	for id := uint64(0); id < p.Meta.PageN; id++ {
+		if free[id] {
+			pages = append(pages, PageInfo{ID: id, Type: PageFree, Size: p.PageSize})
+			continue
+		}
+
+		info, _, err := p.Page(id)
+		if err != nil {
+			return pages, err
+		}
+
+		pages = append(pages, info)
+		id += uint64(info.Overflow)
+	}
+
+	return pages, nil
+}
+
+// Tree walks the B+tree of the nested bucket of path (the root bucket when empty) depth first.
+// An inline bucket is reported as a single leaf page with the id 0.
+func (p *PageFile) Tree(path [][]byte, f func(depth int, info PageInfo, elems []PageElem) bool) error {
+	root, inline := p.Meta.Root, []byte(nil)
+	for _, name := range path {
+		v, err := p.findBucket(root, inline, name)
+		if err != nil {
+			return err
+		}
+
+		if len(v) < bucketHeaderSize {
+			return fmt.Errorf("%w: bucket header of %d bytes", ErrInvalidFile, len(v))
+		}
+
+		root, inline = binary.LittleEndian.Uint64(v), nil
+		if root == 0 {
+			inline = v[bucketHeaderSize:]
+		}
+	}
+
+	if inline != nil {
+		info, elems, err := parsePage(inline)
+		if err == nil {
+			f(0, info, elems)
+		}
+		return err
+	}
+
+	_, err := p.walk(root, 0, map[uint64]bool{}, f)
+	return err
+}
+
+// errPageCycle tells a page is reached twice in a B+tree, which a corrupt child pointer does.
+func errPageCycle(id uint64) error {
+	return fmt.Errorf("%w: page %d is reached twice in the B+tree", ErrInvalidFile, id)
+}
+
+// walk walks the pages from id, the visited ones stop a corrupt tree from looping.
+func (p *PageFile) walk(id uint64, depth int, visited map[uint64]bool,
+	f func(depth int, info PageInfo, elems []PageElem) bool) (bool, error) {
+	if visited[id] {
+		return false, errPageCycle(id)
+	}
+	visited[id] = true
+
+	info, elems, err := p.Page(id)
+	if err != nil {
+		return false, err
+	}
+
+	if !f(depth, info, elems) {
+		return false, nil
+	}
+
+	if info.Type == PageBranch {
+		for _, e := range elems {
+			if ok, err := p.walk(e.Child, depth+1, visited, f); !ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// findBucket finds the bucket header of name in the B+tree of root, or in the inline page.
+func (p *PageFile) findBucket(root uint64, inline []byte, name []byte) ([]byte, error) {
+	buf, visited := inline, map[uint64]bool{}
+	for {
+		if buf == nil {
+			if visited[root] {
+				return nil, errPageCycle(root)
+			}
+			visited[root] = true
+
+			var err error
+			if buf, err = p.readPage(root); err != nil {
+				return nil, err
+			}
+		}
+
+		info, elems, err := parsePage(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Type != PageBranch {
+			for _, e := range elems {
+				if e.Bucket && bytes.Equal(e.Key, name) {
+					return e.Value, nil
+				}
+			}
+			return nil, ErrBucketNotFound
+		}
+
+		if len(elems) == 0 {
+			return nil, fmt.Errorf("%w: branch page %d without elements", ErrInvalidFile, info.ID)
+		}
+
+		// the child i holds the keys from elems[i].Key up to elems[i+1].Key.
+		i := sort.Search(len(elems), func(i int) bool { return bytes.Compare(elems[i].Key, name) > 0 })
+		if i > 0 {
+			i--
+		}
+		root, buf = elems[i].Child, nil
+	}
+}
+
+// UtilizationHistogram counts the branch and leaf pages by their utilization in 10% steps.
+func UtilizationHistogram(pages []PageInfo) [10]int {
+	var h [10]int
+	for _, p := range pages {
+		if p.Type != PageBranch && p.Type != PageLeaf {
+			continue
+		}
+
+		i := int(p.Utilization() * 10)
+		if i > 9 {
+			i = 9
+		}
+		h[i]++
+	}
+
+	return h
+}
@@ -0,0 +1,182 @@
+package boltcli
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPageFile(t *testing.T) {
+	c := newTestDB(t)
+
+	c.WithPath(ParsePath("a/b")...)
+	for i := 0; i < 500; i++ {
+		assert.Nil(t, c.Put([]byte(fmt.Sprintf("key%04d", i)), []byte(strings.Repeat("v", 50))))
+	}
+	assert.Nil(t, c.Put([]byte("big"), []byte(strings.Repeat("x", 10000))))
+	assert.Nil(t, c.WithPath(ParsePath("a/inline")...).Put([]byte("k"), []byte("v")))
+	assert.Nil(t, c.Del([]byte("k")))
+
+	p, err := OpenPageFile(c.DbFile)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	pages, err := p.Pages()
+	assert.Nil(t, err)
+	assert.Equal(t, PageMeta, pages[0].Type)
+	assert.Equal(t, PageMeta, pages[1].Type)
+
+	types := map[string]int{}
+	for _, page := range pages {
+		types[page.Type]++
+	}
+	assert.True(t, types[PageBranch] > 0)
+	assert.True(t, types[PageLeaf] > 1)
+
+	keys, overflow := 0, 0
+	err = p.Tree(ParsePath("a/b"), func(depth int, info PageInfo, elems []PageElem) bool {
+		if info.Type == PageLeaf {
+			keys += len(elems)
+			overflow += info.Overflow
+		}
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 501, keys)
+	assert.True(t, overflow > 0)
+
+	err = p.Tree(ParsePath("a/inline"), func(depth int, info PageInfo, elems []PageElem) bool {
+		assert.Equal(t, PageLeaf, info.Type)
+		assert.Equal(t, 0, len(elems))
+		return true
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, ErrBucketNotFound, p.Tree(ParsePath("a/c"), nil))
+
+	h := UtilizationHistogram(pages)
+	assert.Equal(t, types[PageBranch]+types[PageLeaf], h[0]+h[1]+h[2]+h[3]+h[4]+h[5]+h[6]+h[7]+h[8]+h[9])
+}
+
+func TestParsePageCorrupt(t *testing.T) {
+	le := binary.LittleEndian
+	page := func(flags, count uint16, size int) []byte {
+		buf := make([]byte, size)
+		le.PutUint16(buf[8:], flags)
+		le.PutUint16(buf[10:], count)
+		return buf
+	}
+
+	_, _, err := parsePage(make([]byte, pageHeaderSize-1))
+	assert.True(t, errors.Is(err, ErrInvalidFile))
+
+	// more elements than the page holds.
+	_, _, err = parsePage(page(leafPageFlag, 2, pageHeaderSize+pageElementSize+4))
+	assert.Equal(t, ErrInvalidFile, err)
+	_, _, err = parsePage(page(branchPageFlag, 0xFFFE, 4096))
+	assert.Equal(t, ErrInvalidFile, err)
+
+	// the sizes would overflow 32 bits summed.
+	buf := page(leafPageFlag, 1, 4096)
+	le.PutUint32(buf[pageHeaderSize+4:], 16)
+	le.PutUint32(buf[pageHeaderSize+8:], 0xFFFFFFF0)
+	le.PutUint32(buf[pageHeaderSize+12:], 0x20)
+	_, _, err = parsePage(buf)
+	assert.Equal(t, ErrInvalidFile, err)
+
+	buf = page(branchPageFlag, 1, 4096)
+	le.PutUint32(buf[pageHeaderSize:], 0xFFFFFFFF)
+	le.PutUint32(buf[pageHeaderSize+4:], 2)
+	_, _, err = parsePage(buf)
+	assert.Equal(t, ErrInvalidFile, err)
+
+	// a freelist telling more ids than it holds.
+	buf = page(freelistPageFlag, 0xFFFF, pageHeaderSize+8+16)
+	le.PutUint64(buf[pageHeaderSize:], 1<<60)
+	info, _, err := parsePage(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, pageHeaderSize+8+16, info.Used)
+	assert.Nil(t, freelistIDs(page(freelistPageFlag, 0xFFFF, pageHeaderSize+4)))
+}
+
+func TestPageFileCorrupt(t *testing.T) {
+	c := newTestDB(t)
+	assert.Nil(t, c.WithPath([]byte("a")).Put([]byte("big"), []byte(strings.Repeat("x", 10000))))
+
+	p, err := OpenPageFile(c.DbFile)
+	assert.Nil(t, err)
+	pages, err := p.Pages()
+	assert.Nil(t, err)
+	p.Close()
+
+	data, err := os.ReadFile(c.DbFile)
+	assert.Nil(t, err)
+
+	name, overflows := filepath.Join(t.TempDir(), "corrupt.bolt"), 0
+	for _, page := range pages {
+		if page.Overflow > 0 {
+			overflows++
+			// the overflow count of the page goes far beyond the file.
+			binary.LittleEndian.PutUint32(data[int(page.ID)*p.PageSize+12:], 0xFFFFFFF0)
+			assert.Nil(t, os.WriteFile(name, data, 0o600))
+
+			p, err := OpenPageFile(name)
+			assert.Nil(t, err)
+			_, err = p.readPage(page.ID)
+			assert.True(t, errors.Is(err, ErrInvalidFile))
+			p.Close()
+		}
+	}
+	assert.True(t, overflows > 0)
+
+	// a file shorter than a meta page.
+	assert.Nil(t, os.WriteFile(name, data[:pageHeaderSize+metaSize/2], 0o600))
+	_, err = OpenPageFile(name)
+	assert.True(t, errors.Is(err, ErrInvalidFile))
+}
+
+func TestPageFileCycle(t *testing.T) {
+	c := newTestDB(t)
+	c.WithPath(ParsePath("a/b")...)
+	for i := 0; i < 500; i++ {
+		assert.Nil(t, c.Put([]byte(fmt.Sprintf("key%04d", i)), []byte(strings.Repeat("v", 50))))
+	}
+
+	p, err := OpenPageFile(c.DbFile)
+	assert.Nil(t, err)
+	var branch uint64
+	assert.Nil(t, p.Tree(ParsePath("a/b"), func(depth int, info PageInfo, elems []PageElem) bool {
+		if info.Type == PageBranch && branch == 0 {
+			branch = info.ID
+		}
+		return true
+	}))
+	p.Close()
+	assert.True(t, branch > 0)
+
+	// the first child of the branch page points back to the page itself.
+	data, err := os.ReadFile(c.DbFile)
+	assert.Nil(t, err)
+	binary.LittleEndian.PutUint64(data[int(branch)*p.PageSize+pageHeaderSize+8:], branch)
+	name := filepath.Join(t.TempDir(), "cycle.bolt")
+	assert.Nil(t, os.WriteFile(name, data, 0o600))
+
+	p, err = OpenPageFile(name)
+	assert.Nil(t, err)
+	defer p.Close()
+	err = p.Tree(ParsePath("a/b"), func(int, PageInfo, []PageElem) bool { return true })
+	assert.True(t, errors.Is(err, ErrInvalidFile))
+	err = p.Tree(ParsePath("a/b/key0000"), nil)
+	assert.True(t, errors.Is(err, ErrInvalidFile))
+
+	// a branch page without elements.
+	buf := make([]byte, pageHeaderSize)
+	binary.LittleEndian.PutUint16(buf[8:], branchPageFlag)
+	_, err = p.findBucket(0, buf, []byte("a"))
+	assert.True(t, errors.Is(err, ErrInvalidFile))
+}
@@ -0,0 +1,171 @@
+package boltcli
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// PathSeparator separates the nested bucket names in a path string like a/b/c.
+const PathSeparator = "/"
+
+// ParsePath splits a path string like /a/b into its bucket names, empty names are ignored.
+func ParsePath(s string) [][]byte {
+	var path [][]byte
+	for _, name := range strings.Split(s, PathSeparator) {
+		if name != "" {
+			path = append(path, []byte(name))
+		}
+	}
+
+	return path
+}
+
+// FormatPath formats a bucket path as /a/b, the root is /.
+func FormatPath(path [][]byte) string {
+	return PathSeparator + string(bytes.Join(path, []byte(PathSeparator)))
+}
+
+// EscapePath formats a bucket path as /a/b with the names escaped by EscapeName,
+// so unlike FormatPath the path of a name holding a / is not the one of its nested buckets.
+func EscapePath(path [][]byte) string {
+	names := make([]string, len(path))
+	for i, name := range path {
+		names[i] = EscapeName(name)
+	}
+
+	return PathSeparator + strings.Join(names, PathSeparator)
+}
+
+// EscapeName escapes the / and % of a bucket name and the bytes not valid UTF-8.
+func EscapeName(name []byte) string {
+	var b strings.Builder
+	for len(name) > 0 {
+		r, size := utf8.DecodeRune(name)
+		switch {
+		case r == utf8.RuneError && size == 1, r == '/', r == '%':
+			fmt.Fprintf(&b, "%%%02X", name[0])
+		default:
+			b.Write(name[:size])
+		}
+		name = name[size:]
+	}
+
+	return b.String()
+}
+
+// HasBucket tells whether the nested bucket of path exists, the root always exists.
+func (c *DB) HasBucket(path [][]byte) bool {
+	if len(path) == 0 {
+		return true
+	}
+
+	found := false
+	_ = c.view(func(tx *bolt.Tx) error {
+		found = bucketAt(tx, path) != nil
+		return nil
+	})
+
+	return found
+}
+
+// cursor returns a cursor over the current bucket, or over the top level buckets at the root.
+func (c *DB) cursor(tx *bolt.Tx) (*bolt.Cursor, error) {
+	path := c.path()
+	if len(path) == 0 {
+		return tx.Cursor(), nil
+	}
+
+	b := bucketAt(tx, path)
+	if b == nil {
+		return nil, ErrBucketNotFound
+	}
+
+	return b.Cursor(), nil
+}
+
+// Ls lists the direct children of the current bucket, v is nil for the nested buckets.
+func (c *DB) Ls(f func(index int, k, v []byte) bool) error { return c.LsPrefix(nil, f) }
+
+// LsPrefix lists the direct children of the current bucket starting with prefix like Ls,
+// seeking to the first one and stopping after the last one.
+func (c *DB) LsPrefix(prefix []byte, f func(index int, k, v []byte) bool) error {
+	return c.view(func(tx *bolt.Tx) error {
+		cursor, err := c.cursor(tx)
+		if err != nil {
+			return err
+		}
+
+		k, v := cursor.First()
+		if len(prefix) > 0 {
+			k, v = cursor.Seek(prefix)
+		}
+
+		i, root := 0, len(c.path()) == 0
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			if root && IsHiddenBucket(k) {
+				continue
+			}
+			if !f(i, CloneBytes(k), cloneValue(v)) {
+				break
+			}
+			i++
+		}
+
+		return nil
+	})
+}
+
+// Tree walks the current bucket depth first, descending at most maxDepth levels
+// of nested buckets (0 means no limit). The depth of the direct children is 1
+// and v is nil for the nested buckets.
+func (c *DB) Tree(maxDepth int, f func(depth int, k, v []byte) bool) error {
+	return c.view(func(tx *bolt.Tx) error {
+		cursor, err := c.cursor(tx)
+		if err != nil {
+			return err
+		}
+
+		_, err = walkTree(cursor, 1, maxDepth, len(c.path()) == 0, f)
+		return err
+	})
+}
+
+func walkTree(cursor *bolt.Cursor, depth, maxDepth int, root bool, f func(depth int, k, v []byte) bool) (bool, error) {
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		if root && IsHiddenBucket(k) {
+			continue
+		}
+		if !f(depth, CloneBytes(k), cloneValue(v)) {
+			return false, nil
+		}
+
+		if v != nil || maxDepth > 0 && depth >= maxDepth {
+			continue
+		}
+
+		// the cursor of the root iterates the root bucket, whose Bucket works like tx.Bucket.
+		child := cursor.Bucket().Bucket(k)
+		if child == nil {
+			return false, ErrBucketNotFound
+		}
+
+		if ok, err := walkTree(child.Cursor(), depth+1, maxDepth, false, f); !ok || err != nil {
+			return ok, err
+		}
+	}
+
+	return true, nil
+}
+
+// cloneValue clones v but keeps nil, which marks a nested bucket.
+func cloneValue(v []byte) []byte {
+	if v == nil {
+		return nil
+	}
+
+	return CloneBytes(v)
+}
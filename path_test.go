@@ -0,0 +1,68 @@
+package boltcli
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, ParsePath("/a//b/"))
+	assert.Nil(t, ParsePath("/"))
+	assert.Equal(t, "/a/b", FormatPath(ParsePath("a/b")))
+	assert.Equal(t, "/", FormatPath(nil))
+}
+
+func TestNestedBuckets(t *testing.T) {
+	c := newTestDB(t)
+
+	assert.Nil(t, c.NewBucket([]byte("a"), []byte("b"), []byte("c")))
+	assert.True(t, c.HasBucket(ParsePath("a/b/c")))
+	assert.False(t, c.HasBucket(ParsePath("a/c")))
+
+	assert.Nil(t, c.WithPath(ParsePath("a/b")...).Put([]byte("k1"), []byte("v1")))
+	v, err := c.Get([]byte("k1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(v))
+	assert.Equal(t, "b", string(c.Bucket))
+
+	var ls []string
+	assert.Nil(t, c.Ls(func(_ int, k, v []byte) bool {
+		ls = append(ls, fmt.Sprintf("%s=%v", k, v == nil))
+		return true
+	}))
+	assert.Equal(t, []string{"c=true", "k1=false"}, ls)
+
+	var tree []string
+	assert.Nil(t, c.WithPath().Tree(2, func(depth int, k, v []byte) bool {
+		tree = append(tree, fmt.Sprintf("%d:%s", depth, k))
+		return true
+	}))
+	assert.Equal(t, []string{"1:a", "2:b"}, tree)
+
+	assert.Nil(t, c.DelBucket([]byte("a"), []byte("b")))
+	assert.False(t, c.HasBucket(ParsePath("a/b")))
+	assert.True(t, c.HasBucket(ParsePath("a")))
+}
+
+func TestLsPrefix(t *testing.T) {
+	c := newTestDB(t)
+
+	assert.Nil(t, c.WithPath([]byte("a")).Put([]byte("ab1"), []byte("1"), []byte("ab2"), []byte("2"), []byte("b"), []byte("3")))
+	assert.Nil(t, c.NewBucket([]byte("a"), []byte("ab3")))
+	assert.Nil(t, c.Put([]byte("a"), []byte("0")))
+
+	var ls []string
+	assert.Nil(t, c.LsPrefix([]byte("ab"), func(_ int, k, v []byte) bool {
+		ls = append(ls, fmt.Sprintf("%s=%v", k, v == nil))
+		return true
+	}))
+	assert.Equal(t, []string{"ab1=false", "ab2=false", "ab3=true"}, ls)
+
+	ls = nil
+	assert.Nil(t, c.LsPrefix([]byte("c"), func(_ int, k, v []byte) bool {
+		ls = append(ls, string(k))
+		return true
+	}))
+	assert.Nil(t, ls)
+}
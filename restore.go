@@ -0,0 +1,204 @@
+package boltcli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrTargetLocked = errors.New("target db is opened by another process")
+
+// PrevSuffix is appended to the replaced db file kept by Restore.
+const PrevSuffix = ".prev"
+
+// RestoreOption tunes Restore.
+type RestoreOption struct {
+	// Checksum is the sha256 of the backup file, looked up in the manifests next to it when empty.
+	Checksum string
+	// KeepPrev keeps the replaced target as target.prev.
+	KeepPrev bool
+	// Increments replays the incremental backups of the backup recorded in the manifest next to it.
+	Increments bool
+	// Until stops the replay of the increments before the first transaction committed after it, when not zero.
+	Until time.Time
+}
+
+// Restore replaces the target db file by the backup file. The backup is decompressed when needed
+// and checked by the bolt consistency check into a temporary file next to the target, which is
+// then renamed over the target, so the target is either the old or the restored db at any time.
+// It refuses with ErrTargetLocked when another process has the target opened. The journal of the
+// target in JournalDir is moved aside to the dir with PrevSuffix, it no longer matches the db.
+func Restore(backup, target string, opt RestoreOption) error {
+	if same, _ := sameFile(backup, target); same {
+		return fmt.Errorf("restore %s onto itself", target)
+	}
+
+	// hold the file lock of the target until it is replaced, so no one opens it meanwhile.
+	if IsFileExist(target) {
+		db, err := bolt.Open(target, 0600, &bolt.Options{Timeout: 100 * time.Millisecond})
+		if errors.Is(err, bolt.ErrTimeout) {
+			return ErrTargetLocked
+		}
+		// any other error is after bolt got the lock, e.g. a corrupted target, which is fine to replace.
+		if err == nil {
+			defer db.Close()
+		}
+	}
+
+	m, entry := manifestEntry(backup)
+	if opt.Checksum == "" && entry != nil {
+		opt.Checksum = entry.SHA256
+	}
+
+	tmp, err := ExtractBackup(backup, opt.Checksum, filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // a no-op after the rename
+
+	if err := CheckFile(tmp); err != nil {
+		return fmt.Errorf("check backup %s: %w", backup, err)
+	}
+
+	if opt.Increments {
+		if entry == nil {
+			return fmt.Errorf("no manifest records the backup %s", backup)
+		}
+
+		if err := replayIncrements(tmp, filepath.Dir(backup), m.Increments(entry.File), opt.Until); err != nil {
+			return err
+		}
+
+		if err := CheckFile(tmp); err != nil {
+			return fmt.Errorf("check replayed backup %s: %w", backup, err)
+		}
+	}
+
+	if fi, err := os.Stat(target); err == nil {
+		if err := os.Chmod(tmp, fi.Mode().Perm()); err != nil {
+			return err
+		}
+
+		if opt.KeepPrev {
+			prev := target + PrevSuffix
+			if err := os.Remove(prev); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err := os.Link(target, prev); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.Rename(tmp, target); err != nil {
+		return err
+	}
+
+	if err := rotateJournal(target); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(target))
+}
+
+// rotateJournal moves the journal of the replaced target aside to its dir with PrevSuffix,
+// its records are of the transactions of the replaced db, which the restored one reuses the ids of.
+func rotateJournal(target string) error {
+	dir := JournalDir(target)
+	if !IsFileExist(dir) {
+		return nil
+	}
+
+	if err := os.RemoveAll(dir + PrevSuffix); err != nil {
+		return err
+	}
+
+	return os.Rename(dir, dir+PrevSuffix)
+}
+
+// manifestEntry finds the backup file in the manifests of its dir.
+func manifestEntry(backup string) (*Manifest, *BackupEntry) {
+	dir, name := filepath.Split(backup)
+	files, _ := filepath.Glob(filepath.Join(dir, "*.manifest.json"))
+	for _, file := range files {
+		m, err := LoadManifest(file)
+		if err != nil {
+			continue
+		}
+
+		for i, e := range m.Backups {
+			if e.File == name {
+				return m, &m.Backups[i]
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// replayIncrements replays the incremental backups in dir onto the db file.
+func replayIncrements(dbFile, dir string, increments []BackupEntry, until time.Time) error {
+	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, e := range increments {
+		if err := replayIncrement(db, filepath.Join(dir, e.File), e.SHA256, until); err != nil {
+			return fmt.Errorf("replay %s: %w", e.File, err)
+		}
+	}
+
+	return nil
+}
+
+func replayIncrement(db *bolt.DB, file, checksum string, until time.Time) error {
+	tmp, err := ExtractBackup(file, checksum, filepath.Dir(db.Path()))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	f, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = Replay(db, f, until)
+	return err
+}
+
+func sameFile(a, b string) (bool, error) {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+
+	return os.SameFile(fa, fb), nil
+}
+
+// syncDir persists the rename in the dir.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+
+	return nil
+}
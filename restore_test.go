@@ -0,0 +1,53 @@
+package boltcli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestore(t *testing.T) {
+	c := newTestDB(t)
+	assert.Nil(t, c.Put([]byte("k"), []byte("v1")))
+	dir := t.TempDir()
+	e, err := c.BackupFile(dir, CompressGzip)
+	assert.Nil(t, err)
+	backup := filepath.Join(dir, e.File)
+
+	// the test db is still opened.
+	assert.Equal(t, ErrTargetLocked, Restore(backup, c.DbFile, RestoreOption{}))
+
+	target := filepath.Join(dir, "target.bolt")
+	assert.Nil(t, os.WriteFile(target, []byte("old"), 0640))
+	assert.Nil(t, os.MkdirAll(JournalDir(target), 0700))
+	assert.Nil(t, os.WriteFile(filepath.Join(JournalDir(target), "00000000000000000009.jnl"), []byte("{}\n"), 0600))
+	assert.Nil(t, Restore(backup, target, RestoreOption{KeepPrev: true}))
+	assert.False(t, IsFileExist(JournalDir(target)))
+	assert.True(t, IsFileExist(filepath.Join(JournalDir(target)+PrevSuffix, "00000000000000000009.jnl")))
+
+	prev, err := os.ReadFile(target + PrevSuffix)
+	assert.Nil(t, err)
+	assert.Equal(t, "old", string(prev))
+	fi, err := os.Stat(target)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	restored, err := New(target)
+	assert.Nil(t, err)
+	v, err := restored.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(v))
+	assert.Nil(t, restored.Close())
+
+	// the checksum in the manifest no longer matches a tampered backup.
+	f, err := os.OpenFile(backup, os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, _ = f.Write([]byte("x"))
+	assert.Nil(t, f.Close())
+	assert.Equal(t, ErrChecksumMismatch, Restore(backup, target, RestoreOption{}))
+
+	tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.Empty(t, tmps)
+}
@@ -0,0 +1,214 @@
+package boltcli
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrSnapshotReleased = errors.New("snapshot already released")
+
+// DefaultSnapshotWarn is the default time a snapshot is held before warning about it.
+const DefaultSnapshotWarn = time.Minute
+
+// WithSnapshotWarn logs a warning every d while a snapshot is held, 0 disables the warnings.
+func WithSnapshotWarn(d time.Duration) OptionFn {
+	return func(o *Option) {
+		if o.SnapshotWarn = d; d <= 0 {
+			o.SnapshotWarn = -1
+		}
+	}
+}
+
+// Snapshot is a read only view of the db pinned to one bolt transaction, so a series of reads
+// sees the same data while the writes continue. It keeps the pages freed meanwhile from being
+// reused until Release, so the db file grows while a snapshot is held. A write growing the memory map
+// waits for the release, so a snapshot held along with writes needs WithInitialMmapSize, and it must
+// not be held by the goroutine of such a write.
+type Snapshot struct {
+	db *DB
+	// state is shared by the snapshots of the other paths made by WithPath.
+	state *snapshotState
+}
+
+// snapshotSet tracks the open snapshots of a DB, so Close can release them.
+type snapshotSet struct {
+	mu   sync.Mutex
+	open map[*snapshotState]bool
+}
+
+func (set *snapshotSet) add(st *snapshotState) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	if set.open == nil {
+		set.open = make(map[*snapshotState]bool)
+	}
+	set.open[st] = true
+}
+
+func (set *snapshotSet) remove(st *snapshotState) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	delete(set.open, st)
+}
+
+// releaseAll releases the snapshots left open, bolt would wait for them forever on Close.
+func (set *snapshotSet) releaseAll() {
+	set.mu.Lock()
+	states := make([]*snapshotState, 0, len(set.open))
+	for st := range set.open {
+		states = append(states, st)
+	}
+	set.mu.Unlock()
+
+	for _, st := range states {
+		_ = st.release()
+	}
+}
+
+type snapshotState struct {
+	set *snapshotSet
+
+	// mu serializes the reads, a bolt transaction is not safe for concurrent use.
+	mu       sync.Mutex
+	tx       *bolt.Tx
+	created  time.Time
+	warn     *time.Timer
+	released bool
+}
+
+// Snapshot starts a read transaction, which must be released by Release.
+// It cannot be taken during an explicit transaction, see Begin.
+func (c *DB) Snapshot() (*Snapshot, error) {
+	if c.tx != nil {
+		return nil, ErrTxInProgress
+	}
+
+	tx, err := c.DB.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+
+	db := *c
+	db.tx, db.journal = tx, nil
+	s := &Snapshot{db: &db, state: &snapshotState{set: c.snapshots, tx: tx, created: time.Now()}}
+	c.snapshots.add(s.state)
+	if c.snapshotWarn > 0 {
+		s.scheduleWarn(c.snapshotWarn)
+	}
+
+	return s, nil
+}
+
+func (s *Snapshot) scheduleWarn(d time.Duration) {
+	st := s.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.warn = time.AfterFunc(d, func() {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+
+		if !st.released {
+			log.Printf("WARN: snapshot of tx %d held for %s blocks the reuse of the freed pages, Release it when done",
+				st.tx.ID(), time.Since(st.created).Round(time.Second))
+			st.warn.Reset(d)
+		}
+	})
+}
+
+// Release ends the read transaction of the snapshot, the snapshots made by WithPath included.
+func (s *Snapshot) Release() error { return s.state.release() }
+
+func (st *snapshotState) release() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.released {
+		return ErrSnapshotReleased
+	}
+
+	st.released = true
+	if st.warn != nil {
+		st.warn.Stop()
+	}
+
+	st.set.remove(st)
+	return st.tx.Rollback()
+}
+
+// TxID is the id of the transaction the snapshot is pinned to.
+func (s *Snapshot) TxID() int { return s.state.tx.ID() }
+
+// Age is the time since the snapshot was taken.
+func (s *Snapshot) Age() time.Duration { return time.Since(s.state.created) }
+
+// WithPath returns the snapshot of the same transaction switched to the nested bucket path.
+func (s *Snapshot) WithPath(path ...[]byte) *Snapshot {
+	db := *s.db
+	return &Snapshot{db: db.WithPath(path...), state: s.state}
+}
+
+// WithBucket returns the snapshot of the same transaction switched to the bucket.
+func (s *Snapshot) WithBucket(bucket []byte) *Snapshot { return s.WithPath(bucket) }
+
+func (s *Snapshot) read(fn func(db *DB) error) error {
+	st := s.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.released {
+		return ErrSnapshotReleased
+	}
+
+	return fn(s.db)
+}
+
+func (s *Snapshot) Get(key []byte) (v []byte, err error) {
+	err = s.read(func(db *DB) error {
+		v, err = db.Get(key)
+		return err
+	})
+	return v, err
+}
+
+func (s *Snapshot) Range(min, max []byte, f func(index int, k, v []byte) bool) error {
+	return s.read(func(db *DB) error { return db.Range(min, max, f) })
+}
+
+func (s *Snapshot) PrefixList(prefix []byte, f func(index int, k, v []byte) bool) error {
+	return s.read(func(db *DB) error { return db.PrefixList(prefix, f) })
+}
+
+func (s *Snapshot) List(f func(index int, key, val []byte) bool) error {
+	return s.read(func(db *DB) error { return db.List(f) })
+}
+
+func (s *Snapshot) GetBuckets() (buckets [][]byte, err error) {
+	err = s.read(func(db *DB) error {
+		buckets, err = db.GetBuckets()
+		return err
+	})
+	return buckets, err
+}
+
+func (s *Snapshot) Stats(bucket []byte, nested ...[]byte) (stats bolt.BucketStats, err error) {
+	err = s.read(func(db *DB) error {
+		stats, err = db.Stats(bucket, nested...)
+		return err
+	})
+	return stats, err
+}
+
+func (s *Snapshot) Seq() (seq uint64, err error) {
+	err = s.read(func(db *DB) error {
+		seq, err = db.Seq()
+		return err
+	})
+	return seq, err
+}
@@ -0,0 +1,78 @@
+package boltcli
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	c := newTestDB(t, WithInitialMmapSize(1<<20))
+	assert.Nil(t, c.Put([]byte("k"), []byte("v1")))
+	assert.Nil(t, c.WithPath(ParsePath("a/b")...).Put([]byte("n"), []byte("1")))
+	c.WithBucket([]byte("default"))
+
+	s, err := c.Snapshot()
+	assert.Nil(t, err)
+	assert.Nil(t, c.Put([]byte("k"), []byte("v2"), []byte("k2"), []byte("x")))
+	assert.Nil(t, c.NewBucket([]byte("c")))
+
+	v, err := s.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(v))
+	v, err = c.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(v))
+
+	var keys []string
+	assert.Nil(t, s.PrefixList([]byte("k"), func(_ int, k, _ []byte) bool {
+		keys = append(keys, string(k))
+		return true
+	}))
+	assert.Equal(t, []string{"k"}, keys)
+
+	buckets, err := s.GetBuckets()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("default")}, buckets)
+
+	v, err = s.WithPath(ParsePath("a/b")...).Get([]byte("n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(v))
+
+	stats, err := s.Stats([]byte("default"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.KeyN)
+
+	assert.Nil(t, s.Release())
+	assert.Equal(t, ErrSnapshotReleased, s.Release())
+	_, err = s.WithBucket([]byte("a")).Get([]byte("k"))
+	assert.Equal(t, ErrSnapshotReleased, err)
+
+	assert.Nil(t, c.Begin())
+	_, err = c.Snapshot()
+	assert.Equal(t, ErrTxInProgress, err)
+	_, _ = c.Rollback()
+}
+
+func TestSnapshotWarnAndClose(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	c, err := New(filepath.Join(t.TempDir(), "test.bolt"), WithSnapshotWarn(10*time.Millisecond))
+	assert.Nil(t, err)
+
+	s, err := c.Snapshot()
+	assert.Nil(t, err)
+	time.Sleep(35 * time.Millisecond)
+
+	// Close releases the snapshot left open instead of waiting for it.
+	assert.Nil(t, c.Close())
+	assert.Equal(t, ErrSnapshotReleased, s.Release())
+	assert.Contains(t, buf.String(), "WARN: snapshot of tx")
+}
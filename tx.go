@@ -0,0 +1,108 @@
+package boltcli
+
+import (
+	"errors"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ErrTxInProgress = errors.New("transaction already in progress")
+	ErrNoTx         = errors.New("no transaction in progress")
+)
+
+// Begin starts an explicit writable transaction, all the following calls
+// run inside it until Commit or Rollback.
+func (c *DB) Begin() error {
+	if c.tx != nil {
+		return ErrTxInProgress
+	}
+
+	// the journal stays locked until Commit or Rollback, see journal.
+	if c.journal != nil {
+		c.journal.mu.Lock()
+		c.journal.pending = c.journal.pending[:0]
+	}
+
+	tx, err := c.DB.Begin(true)
+	if err != nil {
+		if c.journal != nil {
+			c.journal.mu.Unlock()
+		}
+		return err
+	}
+
+	c.tx, c.pending = tx, 0
+	return nil
+}
+
+// Commit commits the explicit transaction and returns the number of updates it contained.
+func (c *DB) Commit() (int, error) {
+	if c.tx == nil {
+		return 0, ErrNoTx
+	}
+
+	tx, pending := c.tx, c.pending
+	c.tx, c.pending = nil, 0
+	if c.journal != nil {
+		return pending, c.journal.commit(tx)
+	}
+
+	return pending, tx.Commit()
+}
+
+// Rollback discards the explicit transaction and returns the number of updates it contained.
+func (c *DB) Rollback() (int, error) {
+	if c.tx == nil {
+		return 0, ErrNoTx
+	}
+
+	tx, pending := c.tx, c.pending
+	c.tx, c.pending = nil, 0
+	if c.journal != nil {
+		defer c.journal.mu.Unlock()
+		c.journal.pending = c.journal.pending[:0]
+	}
+
+	return pending, tx.Rollback()
+}
+
+// InTx tells whether an explicit transaction is in progress.
+func (c *DB) InTx() bool { return c.tx != nil }
+
+// Pending returns the number of updates made in the explicit transaction.
+func (c *DB) Pending() int { return c.pending }
+
+func (c *DB) view(fn func(tx *bolt.Tx) error) error {
+	if c.tx != nil {
+		return fn(c.tx)
+	}
+
+	return c.DB.View(fn)
+}
+
+// update runs fn in the explicit transaction if there is one,
+// note that a failed fn may leave partial changes in it.
+func (c *DB) update(fn func(tx *bolt.Tx) error) error {
+	if c.tx == nil {
+		if c.journal != nil {
+			return c.journal.update(c.DB, fn)
+		}
+		return c.DB.Update(fn)
+	}
+
+	mark := 0
+	if c.journal != nil {
+		mark = len(c.journal.pending)
+	}
+
+	if err := fn(c.tx); err != nil {
+		if c.journal != nil {
+			c.journal.pending = c.journal.pending[:mark]
+		}
+		return err
+	}
+
+	c.pending++
+	return nil
+}
@@ -0,0 +1,43 @@
+package boltcli
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTx(t *testing.T) {
+	c := newTestDB(t)
+
+	assert.Nil(t, c.Begin())
+	assert.Equal(t, ErrTxInProgress, c.Begin())
+	assert.True(t, c.InTx())
+
+	assert.Nil(t, c.Put([]byte("name"), []byte("bingoo")))
+	assert.Nil(t, c.Put([]byte("age"), []byte("18")))
+	assert.Equal(t, 2, c.Pending())
+
+	v, err := c.Get([]byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, "bingoo", string(v))
+
+	n, err := c.Rollback()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.False(t, c.InTx())
+
+	_, err = c.Get([]byte("name"))
+	assert.Equal(t, ErrBucketNotFound, err)
+
+	assert.Nil(t, c.Begin())
+	assert.Nil(t, c.Put([]byte("name"), []byte("huang")))
+	n, err = c.Commit()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	v, err = c.Get([]byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, "huang", string(v))
+
+	_, err = c.Commit()
+	assert.Equal(t, ErrNoTx, err)
+}
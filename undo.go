@@ -0,0 +1,306 @@
+package boltcli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// UndoBucket is the hidden top level bucket keeping the undo log enabled by WithUndo.
+const UndoBucket = "__boltcli_undo__"
+
+// hiddenPrefix prefixes the top level buckets used by the library itself.
+const hiddenPrefix = "__boltcli_"
+
+// IsHiddenBucket tells whether a top level bucket is used by the library itself,
+// these buckets are not listed by GetBuckets, Ls and Tree.
+func IsHiddenBucket(name []byte) bool {
+	return bytes.HasPrefix(name, []byte(hiddenPrefix))
+}
+
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// The operations recorded in the undo log.
+const (
+	OpPut       = "put"
+	OpDel       = "del"
+	OpDelBucket = "bucket.del"
+	OpSetSeq    = "seq.set"
+)
+
+// UndoEntry records the state before a destructive operation.
+type UndoEntry struct {
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	// Path is the bucket of the keys, or the deleted bucket itself for OpDelBucket.
+	Path [][]byte `json:"path"`
+	// Items are the previous values, Missing the keys that did not exist before.
+	Items   []KeyValue `json:"items,omitempty"`
+	Missing [][]byte   `json:"missing,omitempty"`
+	// Seq is the previous sequence for OpSetSeq.
+	Seq uint64 `json:"seq,omitempty"`
+	// Bucket is the deleted bucket with its nested buckets for OpDelBucket.
+	Bucket *BucketNode `json:"bucket,omitempty"`
+}
+
+func (e UndoEntry) String() string {
+	s := fmt.Sprintf("#%d %s %-10s %s", e.ID, e.Time.Format("2006-01-02 15:04:05"), e.Op, FormatPath(e.Path))
+	switch e.Op {
+	case OpSetSeq:
+		return s + fmt.Sprintf(" seq=%d", e.Seq)
+	case OpDelBucket:
+		return s
+	}
+
+	var keys [][]byte
+	for _, item := range e.Items {
+		keys = append(keys, item.Key)
+	}
+
+	return s + " " + string(bytes.Join(append(keys, e.Missing...), []byte(", ")))
+}
+
+// WithUndo records the previous state of the destructive operations (put over an existing key,
+// del, bucket deletion and seq.set) in the hidden UndoBucket, keeping the latest keep entries.
+func WithUndo(keep int) OptionFn { return func(o *Option) { o.UndoKeep = keep } }
+
+// DefaultUndoMaxBucketSize is the size of the largest bucket deletion recorded in the undo log by default.
+const DefaultUndoMaxBucketSize = 8 << 20
+
+// WithUndoMaxBucketSize records the bucket deletions in the undo log up to size bytes of names, keys and values,
+// the larger buckets are deleted without an undo entry and a warning.
+func WithUndoMaxBucketSize(size int64) OptionFn {
+	return func(o *Option) { o.UndoMaxBucketSize = size }
+}
+
+// recordKeys records the previous values of keys in b before op changes them.
+func (c *DB) recordKeys(tx *bolt.Tx, op string, b *bolt.Bucket, keys ...[]byte) error {
+	if c.undoKeep <= 0 {
+		return nil
+	}
+
+	e := &UndoEntry{Op: op, Path: c.path()}
+	for _, k := range keys {
+		if v := b.Get(k); v != nil {
+			e.Items = append(e.Items, KeyValue{Key: CloneBytes(k), Value: CloneBytes(v)})
+		} else {
+			e.Missing = append(e.Missing, CloneBytes(k))
+		}
+	}
+
+	if len(e.Items) == 0 && op == OpDel {
+		return nil
+	}
+
+	return c.recordUndo(tx, e)
+}
+
+func (c *DB) recordUndo(tx *bolt.Tx, e *UndoEntry) error {
+	if c.undoKeep <= 0 {
+		return nil
+	}
+
+	b, err := tx.CreateBucketIfNotExists([]byte(UndoBucket))
+	if err != nil {
+		return err
+	}
+
+	if e.ID, err = b.NextSequence(); err != nil {
+		return err
+	}
+	e.Time = time.Now()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := b.Put(itob(e.ID), data); err != nil {
+		return err
+	}
+
+	return pruneUndo(b, c.undoKeep)
+}
+
+// pruneUndo deletes the oldest entries beyond keep.
+// The keys are counted by the cursor, Stats would miss the ones put in this transaction.
+func pruneUndo(b *bolt.Bucket, keep int) error {
+	n := 0
+	cursor := b.Cursor()
+	for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+		n++
+	}
+
+	for ; n > keep; n-- {
+		k, _ := cursor.First()
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// UndoList returns the undo log, the latest entry first.
+func (c *DB) UndoList() ([]UndoEntry, error) {
+	var entries []UndoEntry
+	err := c.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(UndoBucket))
+		if b == nil {
+			return nil
+		}
+
+		cursor := b.Cursor()
+		for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+			var e UndoEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// Undo restores the state recorded by the latest undo entry and removes it from the log.
+func (c *DB) Undo() (*UndoEntry, error) {
+	var e UndoEntry
+	err := c.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(UndoBucket))
+		if b == nil {
+			return ErrNothingToUndo
+		}
+
+		k, v := b.Cursor().Last()
+		if k == nil {
+			return ErrNothingToUndo
+		}
+
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+
+		if err := c.versionUndo(tx, &e); err != nil {
+			return err
+		}
+
+		if err := e.apply(tx); err != nil {
+			return err
+		}
+
+		c.journalUndo(&e)
+		return b.Delete(k)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (e *UndoEntry) apply(tx *bolt.Tx) error {
+	if e.Op == OpDelBucket {
+		return e.restoreBucket(tx)
+	}
+
+	b, err := createBucketAt(tx, e.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range e.Items {
+		if err := b.Put(item.Key, item.Value); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range e.Missing {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	if e.Op == OpSetSeq {
+		return b.SetSequence(e.Seq)
+	}
+
+	return nil
+}
+
+func (e *UndoEntry) restoreBucket(tx *bolt.Tx) error {
+	if len(e.Path) == 0 || e.Bucket == nil {
+		return fmt.Errorf("undo #%d: no bucket recorded", e.ID)
+	}
+
+	create := tx.CreateBucket
+	if parentPath := e.Path[:len(e.Path)-1]; len(parentPath) > 0 {
+		parent, err := createBucketAt(tx, parentPath)
+		if err != nil {
+			return err
+		}
+		create = parent.CreateBucket
+	}
+
+	b, err := create(e.Path[len(e.Path)-1])
+	if err != nil {
+		return fmt.Errorf("undo #%d: restore bucket %s: %w", e.ID, FormatPath(e.Path), err)
+	}
+
+	_, err = e.Bucket.writeTo(b)
+	return err
+}
+
+// journalUndo records the writes made by undoing e.
+func (c *DB) journalUndo(e *UndoEntry) {
+	switch {
+	case e.Op == OpDelBucket:
+		c.journalAdd(JournalRecord{Op: OpNewBucket, Path: e.Path})
+		c.journalAdd(JournalRecord{Op: OpPutBucket, Path: e.Path, Bucket: e.Bucket})
+		return
+	case e.Op == OpSetSeq:
+		c.journalAdd(JournalRecord{Op: OpSetSeq, Path: e.Path, Seq: e.Seq})
+	}
+
+	if len(e.Items) > 0 {
+		c.journalAdd(JournalRecord{Op: OpPut, Path: e.Path, Items: e.Items})
+	}
+	if len(e.Missing) > 0 {
+		c.journalAdd(JournalRecord{Op: OpDel, Path: e.Path, Keys: e.Missing})
+	}
+}
+
+// versionUndo records the values restored by undoing e as new versions of the keys.
+func (c *DB) versionUndo(tx *bolt.Tx, e *UndoEntry) error {
+	b := bucketAt(tx, e.Path)
+	if e.Op == OpDelBucket || b == nil {
+		return nil
+	}
+
+	db := *c
+	db.WithPath(e.Path...)
+	if err := db.recordVersions(tx, b, OpPut, e.Items); err != nil {
+		return err
+	}
+
+	var missing []KeyValue
+	for _, k := range e.Missing {
+		missing = append(missing, KeyValue{Key: k})
+	}
+
+	return db.recordVersions(tx, b, OpDel, missing)
+}
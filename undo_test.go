@@ -0,0 +1,88 @@
+package boltcli
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	c := newTestDB(t, WithUndo(3))
+
+	assert.Nil(t, c.Put([]byte("name"), []byte("bingoo")))
+	assert.Nil(t, c.Put([]byte("name"), []byte("huang"), []byte("age"), []byte("18")))
+	assert.Nil(t, c.SetSeq(10))
+	assert.Nil(t, c.Del([]byte("age")))
+
+	entries, err := c.UndoList()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, OpDel, entries[0].Op)
+
+	buckets, err := c.GetBuckets()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("default")}, buckets)
+
+	e, err := c.Undo()
+	assert.Nil(t, err)
+	assert.Equal(t, OpDel, e.Op)
+	v, _ := c.Get([]byte("age"))
+	assert.Equal(t, "18", string(v))
+
+	_, err = c.Undo()
+	assert.Nil(t, err)
+	seq, _ := c.Seq()
+	assert.Equal(t, uint64(0), seq)
+
+	_, err = c.Undo()
+	assert.Nil(t, err)
+	v, _ = c.Get([]byte("name"))
+	assert.Equal(t, "bingoo", string(v))
+	v, _ = c.Get([]byte("age"))
+	assert.Equal(t, "", string(v))
+
+	_, err = c.Undo()
+	assert.Equal(t, ErrNothingToUndo, err)
+}
+
+func TestUndoDelBucket(t *testing.T) {
+	c := newTestDB(t, WithUndo(10))
+
+	assert.Nil(t, c.WithPath(ParsePath("a/b")...).Put([]byte("k"), []byte("v")))
+	assert.Nil(t, c.SetSeq(7))
+	assert.Nil(t, c.DelBucket([]byte("a")))
+	assert.False(t, c.HasBucket(ParsePath("a")))
+
+	e, err := c.Undo()
+	assert.Nil(t, err)
+	assert.Equal(t, OpDelBucket, e.Op)
+
+	v, err := c.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(v))
+	seq, _ := c.Seq()
+	assert.Equal(t, uint64(7), seq)
+}
+
+func TestUndoDelLargeBucket(t *testing.T) {
+	c := newTestDB(t, WithUndo(10), WithUndoMaxBucketSize(1000))
+
+	assert.Nil(t, c.WithPath(ParsePath("small")...).Put([]byte("k"), []byte("v")))
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, c.WithPath(ParsePath("large/nested")...).Put([]byte(strconv.Itoa(i)), bytes.Repeat([]byte("v"), 200)))
+	}
+
+	// the large bucket is deleted without an undo entry.
+	assert.Nil(t, c.DelBucket([]byte("large")))
+	assert.False(t, c.HasBucket(ParsePath("large")))
+	entries, err := c.UndoList()
+	assert.Nil(t, err)
+	assert.Equal(t, OpPut, entries[0].Op)
+
+	assert.Nil(t, c.DelBucket([]byte("small")))
+	entries, err = c.UndoList()
+	assert.Nil(t, err)
+	assert.Equal(t, OpDelBucket, entries[0].Op)
+	assert.Equal(t, "/small", FormatPath(entries[0].Path))
+}
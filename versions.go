@@ -0,0 +1,471 @@
+package boltcli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/user"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// VersionsBucket is the hidden top level bucket keeping a shadow bucket of versions for each versioned bucket,
+// named by the path of the bucket escaped by EscapePath.
+const VersionsBucket = "__boltcli_versions__"
+
+var (
+	ErrNotVersioned    = errors.New("bucket is not versioned")
+	ErrVersionNotFound = errors.New("version not found")
+)
+
+// versionLimitKey keeps the version limit in the shadow bucket, the version keys start with a non zero length.
+var versionLimitKey = []byte{0}
+
+// Version is a value of a key in a versioned bucket, written by Op at Time.
+// A value existing before the bucket was versioned is its first version with a zero Time.
+type Version struct {
+	Version uint64    `json:"version"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user,omitempty"`
+	// Op is OpPut, or OpDel for a deleted key with no Value.
+	Op    string `json:"op"`
+	Value []byte `json:"value,omitempty"`
+}
+
+func (v Version) String() string {
+	t := "-"
+	if !v.Time.IsZero() {
+		t = v.Time.Format("2006-01-02 15:04:05")
+	}
+
+	user := v.User
+	if user == "" {
+		user = "-"
+	}
+
+	s := fmt.Sprintf("#%d %s %s %-3s", v.Version, t, user, v.Op)
+	if v.Op == OpDel {
+		return s
+	}
+
+	return s + " " + string(v.Value)
+}
+
+// WithUser sets the author recorded in the versions written by the DB.
+func WithUser(user string) OptionFn { return func(o *Option) { o.User = user } }
+
+// SetUser sets the author recorded in the versions written by the DB, see WithUser.
+func (c *DB) SetUser(user string) *DB {
+	c.user = user
+	return c
+}
+
+// loginUser is the name of the user running the process, empty if unknown.
+func loginUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+// EnableVersions makes the current bucket versioned, every Put and Del of a key then keeps its value as
+// a new version, up to limit versions per key, 0 keeps all. Enabling it again changes the limit.
+func (c *DB) EnableVersions(limit int) error {
+	path := c.path()
+	if len(path) == 0 || IsHiddenBucket(path[0]) {
+		return fmt.Errorf("versions of bucket %s: %w", FormatPath(path), bolt.ErrBucketNameRequired)
+	}
+
+	if limit < 0 {
+		limit = 0
+	}
+
+	return c.update(func(tx *bolt.Tx) error {
+		if _, err := createBucketAt(tx, path); err != nil {
+			return err
+		}
+
+		shadow := versionsPath(path)
+		vb, err := createBucketAt(tx, shadow)
+		if err != nil {
+			return err
+		}
+
+		items := []KeyValue{{Key: versionLimitKey, Value: itob(uint64(limit))}}
+		c.journalAdd(JournalRecord{Op: OpPut, Path: shadow, Items: items})
+		if err := vb.Put(versionLimitKey, itob(uint64(limit))); err != nil {
+			return err
+		}
+
+		return c.pruneAllVersions(vb, shadow, limit)
+	})
+}
+
+// DisableVersions stops versioning the current bucket and drops its versions.
+func (c *DB) DisableVersions() error {
+	name := []byte(EscapePath(c.path()))
+	return c.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(VersionsBucket))
+		if b == nil || b.Bucket(name) == nil {
+			return ErrNotVersioned
+		}
+
+		c.journalAdd(JournalRecord{Op: OpDelBucket, Path: [][]byte{[]byte(VersionsBucket), name}})
+		return b.DeleteBucket(name)
+	})
+}
+
+// VersionLimit returns the version limit of the current bucket, ErrNotVersioned if it is not versioned.
+func (c *DB) VersionLimit() (limit int, err error) {
+	err = c.view(func(tx *bolt.Tx) error {
+		vb := versionsOf(tx, c.path())
+		if vb == nil {
+			return ErrNotVersioned
+		}
+
+		limit = int(binary.BigEndian.Uint64(vb.Get(versionLimitKey)))
+		return nil
+	})
+
+	return limit, err
+}
+
+// History returns the versions of the key in the current bucket, the latest first.
+func (c *DB) History(key []byte) ([]Version, error) {
+	var versions []Version
+	err := c.view(func(tx *bolt.Tx) error {
+		vb := versionsOf(tx, c.path())
+		if vb == nil {
+			return ErrNotVersioned
+		}
+
+		var err error
+		versions, err = readVersions(vb, key)
+		return err
+	})
+
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+
+	return versions, err
+}
+
+// GetAt returns the given version of the key in the current bucket.
+func (c *DB) GetAt(key []byte, version uint64) (*Version, error) {
+	return c.findVersion(key, func(v Version) bool { return v.Version == version })
+}
+
+// GetAtTime returns the version of the key in the current bucket at the time t,
+// ErrVersionNotFound if t is before its oldest version kept.
+func (c *DB) GetAtTime(key []byte, t time.Time) (*Version, error) {
+	var found *Version
+	_, err := c.findVersion(key, func(v Version) bool {
+		if v.Time.After(t) {
+			return true
+		}
+		found = &v
+		return false
+	})
+	if found != nil {
+		return found, nil
+	}
+	if err == nil {
+		err = ErrVersionNotFound
+	}
+
+	return nil, err
+}
+
+// findVersion returns the first version of the key, the oldest first, matched by f.
+func (c *DB) findVersion(key []byte, f func(Version) bool) (*Version, error) {
+	var found *Version
+	err := c.view(func(tx *bolt.Tx) error {
+		vb := versionsOf(tx, c.path())
+		if vb == nil {
+			return ErrNotVersioned
+		}
+
+		versions, err := readVersions(vb, key)
+		for i := range versions {
+			if f(versions[i]) {
+				found = &versions[i]
+				return nil
+			}
+		}
+		if err == nil {
+			err = ErrVersionNotFound
+		}
+
+		return err
+	})
+
+	return found, err
+}
+
+// Revert writes the given version of the key in the current bucket back, or deletes the key
+// when the version is a deletion. The revert itself is recorded as the latest version.
+func (c *DB) Revert(key []byte, version uint64) (*Version, error) {
+	var found *Version
+	err := c.update(func(tx *bolt.Tx) error {
+		vb := versionsOf(tx, c.path())
+		if vb == nil {
+			return ErrNotVersioned
+		}
+
+		data := vb.Get(versionKey(key, version))
+		if data == nil {
+			return ErrVersionNotFound
+		}
+
+		found = &Version{}
+		if err := json.Unmarshal(data, found); err != nil {
+			return err
+		}
+
+		b, err := createBucketAt(tx, c.path())
+		if err != nil {
+			return err
+		}
+
+		if found.Op == OpDel {
+			return c.del(tx, b, key)
+		}
+
+		return c.put(tx, b, []KeyValue{{Key: key, Value: found.Value}})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// versionsPath is the path of the shadow bucket of the versions of the bucket of path.
+func versionsPath(path [][]byte) [][]byte {
+	return [][]byte{[]byte(VersionsBucket), []byte(EscapePath(path))}
+}
+
+// versionsOf returns the shadow bucket of the versioned bucket of path, or nil if it is not versioned.
+func versionsOf(tx *bolt.Tx, path [][]byte) *bolt.Bucket {
+	if len(path) == 0 || IsHiddenBucket(path[0]) {
+		return nil
+	}
+
+	return bucketAt(tx, versionsPath(path))
+}
+
+// dropVersions deletes the shadow buckets of the bucket of path and of its nested buckets, which are deleted.
+func (c *DB) dropVersions(tx *bolt.Tx, path [][]byte) error {
+	vbs := tx.Bucket([]byte(VersionsBucket))
+	if vbs == nil || len(path) == 0 || IsHiddenBucket(path[0]) {
+		return nil
+	}
+
+	name := []byte(EscapePath(path))
+	var names [][]byte
+	cursor := vbs.Cursor()
+	for k, _ := cursor.Seek(name); k != nil && bytes.HasPrefix(k, name); k, _ = cursor.Next() {
+		if len(k) == len(name) || k[len(name)] == PathSeparator[0] {
+			names = append(names, CloneBytes(k))
+		}
+	}
+
+	for _, n := range names {
+		c.journalAdd(JournalRecord{Op: OpDelBucket, Path: [][]byte{[]byte(VersionsBucket), n}})
+		if err := vbs.DeleteBucket(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// versionKey is the length of the key as uvarint, the key and the big endian version,
+// so the versions of a key are sorted and not mixed with the ones of the keys it prefixes.
+func versionKey(key []byte, version uint64) []byte {
+	k := versionPrefix(key)
+	return append(k, itob(version)...)
+}
+
+func versionPrefix(key []byte) []byte {
+	k := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(key)+8)
+	n := binary.PutUvarint(k, uint64(len(key)))
+	return append(k[:n], key...)
+}
+
+// lastVersion reads the latest version of the key in the shadow bucket, nil if it has none.
+func lastVersion(vb *bolt.Bucket, key []byte) (*Version, error) {
+	prefix := versionPrefix(key)
+	cursor := vb.Cursor()
+	k, v := cursor.Seek(versionKey(key, math.MaxUint64))
+	if k == nil || !bytes.Equal(k, versionKey(key, math.MaxUint64)) {
+		k, v = cursor.Prev()
+	}
+	if k == nil || !bytes.HasPrefix(k, prefix) {
+		return nil, nil
+	}
+
+	last := &Version{}
+	if err := json.Unmarshal(v, last); err != nil {
+		return nil, fmt.Errorf("version of key %s: %w", key, err)
+	}
+
+	return last, nil
+}
+
+// readVersions reads the versions of the key in the shadow bucket, the oldest first.
+func readVersions(vb *bolt.Bucket, key []byte) ([]Version, error) {
+	var versions []Version
+	prefix := versionPrefix(key)
+	cursor := vb.Cursor()
+	for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+		var ver Version
+		if err := json.Unmarshal(v, &ver); err != nil {
+			return versions, fmt.Errorf("version of key %s: %w", key, err)
+		}
+		versions = append(versions, ver)
+	}
+
+	return versions, nil
+}
+
+// recordVersions records the items written by op into b as the new versions of their keys
+// when the current bucket is versioned. A key without versions gets its existing value as
+// its first version, and a deletion of a missing key is not recorded. Only the latest
+// version of a key is read, the history is not.
+func (c *DB) recordVersions(tx *bolt.Tx, b *bolt.Bucket, op string, items []KeyValue) error {
+	path := c.path()
+	vb := versionsOf(tx, path)
+	if vb == nil {
+		return nil
+	}
+
+	shadow := versionsPath(path)
+	limit := int(binary.BigEndian.Uint64(vb.Get(versionLimitKey)))
+	now := time.Now()
+	for _, item := range items {
+		last, err := lastVersion(vb, item.Key)
+		if err != nil {
+			return err
+		}
+
+		if last == nil {
+			if old := b.Get(item.Key); old != nil {
+				last = &Version{Version: 1, Op: OpPut, Value: CloneBytes(old)}
+				if err := c.putVersion(vb, shadow, item.Key, last); err != nil {
+					return err
+				}
+			}
+		}
+
+		if op == OpDel && (last == nil || last.Op == OpDel) {
+			continue
+		}
+
+		v := &Version{Version: 1, Time: now, User: c.user, Op: op}
+		if last != nil {
+			v.Version = last.Version + 1
+		}
+		if op == OpPut {
+			v.Value = item.Value
+		}
+		if err := c.putVersion(vb, shadow, item.Key, v); err != nil {
+			return err
+		}
+
+		if err := c.pruneVersions(vb, shadow, item.Key, v.Version, limit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *DB) putVersion(vb *bolt.Bucket, shadow [][]byte, key []byte, v *Version) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	k := versionKey(key, v.Version)
+	c.journalAdd(JournalRecord{Op: OpPut, Path: shadow, Items: []KeyValue{{Key: k, Value: data}}})
+	return vb.Put(k, data)
+}
+
+// pruneVersions deletes the oldest versions of the key beyond limit of the ones up to the latest, 0 keeps all.
+// The versions of a key are numbered one by one, so the ones kept are the last limit numbers.
+func (c *DB) pruneVersions(vb *bolt.Bucket, shadow [][]byte, key []byte, latest uint64, limit int) error {
+	if limit <= 0 || latest <= uint64(limit) {
+		return nil
+	}
+
+	var keys [][]byte
+	prefix, oldest := versionPrefix(key), latest-uint64(limit)
+	cursor := vb.Cursor()
+	for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+		if binary.BigEndian.Uint64(k[len(k)-8:]) > oldest {
+			break
+		}
+		keys = append(keys, CloneBytes(k))
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for _, k := range keys {
+		if err := vb.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	c.journalAdd(JournalRecord{Op: OpDel, Path: shadow, Keys: keys})
+	return nil
+}
+
+// pruneAllVersions applies a new limit to the versions of all the keys in the shadow bucket.
+func (c *DB) pruneAllVersions(vb *bolt.Bucket, shadow [][]byte, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	var keys [][]byte
+	cursor := vb.Cursor()
+	for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+		if !bytes.Equal(k, versionLimitKey) {
+			keys = append(keys, CloneBytes(k))
+		}
+	}
+
+	// the keys of the versions of a key are adjacent and end with the version, the latest last.
+	var pruned [][]byte
+	for i := 0; i < len(keys); {
+		j := i + 1
+		for j < len(keys) && bytes.Equal(keys[j][:len(keys[j])-8], keys[i][:len(keys[i])-8]) {
+			j++
+		}
+		if j-i > limit {
+			pruned = append(pruned, keys[i:j-limit]...)
+		}
+		i = j
+	}
+
+	for _, k := range pruned {
+		if err := vb.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	if len(pruned) > 0 {
+		c.journalAdd(JournalRecord{Op: OpDel, Path: shadow, Keys: pruned})
+	}
+
+	return nil
+}
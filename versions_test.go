@@ -0,0 +1,128 @@
+package boltcli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersions(t *testing.T) {
+	c := newTestDB(t, WithUser("bingoo"))
+
+	assert.Nil(t, c.Put([]byte("name"), []byte("v0")))
+	_, err := c.History([]byte("name"))
+	assert.Equal(t, ErrNotVersioned, err)
+
+	assert.Nil(t, c.EnableVersions(3))
+	limit, err := c.VersionLimit()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, limit)
+
+	assert.Nil(t, c.Put([]byte("name"), []byte("v1")))
+	middle := time.Now()
+	assert.Nil(t, c.Put([]byte("name"), []byte("v2"), []byte("na"), []byte("other")))
+	assert.Nil(t, c.Del([]byte("name")))
+	assert.Nil(t, c.Del([]byte("name")))
+
+	// the pre existing v0 is pruned by the limit, the second del is not recorded.
+	versions, err := c.History([]byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(versions))
+	assert.Equal(t, uint64(4), versions[0].Version)
+	assert.Equal(t, OpDel, versions[0].Op)
+	assert.Equal(t, "v2", string(versions[1].Value))
+	assert.Equal(t, "bingoo", versions[1].User)
+	assert.Equal(t, "v1", string(versions[2].Value))
+
+	versions, err = c.History([]byte("na"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(versions))
+
+	v, err := c.GetAt([]byte("name"), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(v.Value))
+	_, err = c.GetAt([]byte("name"), 1)
+	assert.Equal(t, ErrVersionNotFound, err)
+
+	v, err = c.GetAtTime([]byte("name"), middle)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(v.Value))
+	_, err = c.GetAtTime([]byte("name"), middle.Add(-time.Hour))
+	assert.Equal(t, ErrVersionNotFound, err)
+
+	v, err = c.Revert([]byte("name"), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(v.Value))
+	value, _ := c.Get([]byte("name"))
+	assert.Equal(t, "v1", string(value))
+
+	versions, _ = c.History([]byte("name"))
+	assert.Equal(t, uint64(5), versions[0].Version)
+	assert.Equal(t, OpPut, versions[0].Op)
+
+	buckets, err := c.GetBuckets()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("default")}, buckets)
+
+	assert.Nil(t, c.DisableVersions())
+	_, err = c.History([]byte("name"))
+	assert.Equal(t, ErrNotVersioned, err)
+}
+
+func TestVersionsSeedAndUndo(t *testing.T) {
+	c := newTestDB(t, WithUndo(3))
+
+	assert.Nil(t, c.Put([]byte("name"), []byte("v0")))
+	assert.Nil(t, c.EnableVersions(0))
+	assert.Nil(t, c.Put([]byte("name"), []byte("v1")))
+
+	versions, err := c.History([]byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, "v0", string(versions[1].Value))
+	assert.True(t, versions[1].Time.IsZero())
+
+	v, err := c.GetAtTime([]byte("name"), time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, "v0", string(v.Value))
+
+	_, err = c.Undo()
+	assert.Nil(t, err)
+	versions, _ = c.History([]byte("name"))
+	assert.Equal(t, 3, len(versions))
+	assert.Equal(t, "v0", string(versions[0].Value))
+}
+
+func TestVersionsDelBucket(t *testing.T) {
+	c := newTestDB(t)
+
+	ab := *c
+	ab.WithPath([]byte("a/b"))
+	assert.Nil(t, ab.EnableVersions(0))
+	assert.Nil(t, ab.Put([]byte("k"), []byte("v1")))
+
+	// the nested bucket b of a does not share the versions of the bucket named a/b.
+	nested := *c
+	nested.WithPath([]byte("a"), []byte("b"))
+	_, err := nested.History([]byte("k"))
+	assert.Equal(t, ErrNotVersioned, err)
+	assert.Nil(t, nested.EnableVersions(0))
+	assert.Nil(t, nested.Put([]byte("k"), []byte("n1")))
+
+	versions, err := ab.History([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(versions))
+
+	// deleting a drops the versions of its nested bucket, a recreated one starts afresh.
+	assert.Nil(t, c.DelBucket([]byte("a")))
+	_, err = nested.History([]byte("k"))
+	assert.Equal(t, ErrNotVersioned, err)
+	versions, err = ab.History([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(versions))
+
+	assert.Nil(t, c.DelBucket([]byte("a/b")))
+	_, err = ab.History([]byte("k"))
+	assert.Equal(t, ErrNotVersioned, err)
+}